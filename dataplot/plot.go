@@ -8,10 +8,10 @@ import (
 	"math"
 )
 
-func PlotManagedSlice(data *managedslice.Slice, vx, vy int) {
+func PlotManagedSlice(data *managedslice.Slice[storables.StorableFloat], vx, vy int) {
 	datapoints := make([]float64, data.Len())
 	for i := 0; i < len(datapoints); i++ {
-		datapoints[i] = float64(data.At(i).(storables.StorableFloat))
+		datapoints[i] = float64(data.At(i))
 	}
 	Plot(datapoints, vx, vy)
 }
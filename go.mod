@@ -4,13 +4,11 @@ go 1.21
 
 require (
 	github.com/paul-at-nangalan/errorhandler v0.0.0-20220524092750-75ec0f2eca41
+	github.com/paul-at-nangalan/short-term-store v0.0.0-20240301041402-7181f5c6b4fb
 	github.com/paul-at-nangalan/stats v0.0.0-20240118092119-ce23f92c79d2
+	golang.org/x/exp v0.0.0-20230321023759-10a507213a29
 	gonum.org/v1/gonum v0.14.0
 	gotest.tools/v3 v3.5.1
 )
 
-require (
-	github.com/google/go-cmp v0.5.9 // indirect
-	github.com/paul-at-nangalan/short-term-store v0.0.0-20240301041402-7181f5c6b4fb // indirect
-	golang.org/x/exp v0.0.0-20230321023759-10a507213a29 // indirect
-)
+require github.com/google/go-cmp v0.5.9 // indirect
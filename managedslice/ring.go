@@ -0,0 +1,102 @@
+package managedslice
+
+import (
+	"github.com/paul-at-nangalan/short-term-store/store"
+	"time"
+)
+
+/*
+*
+A ring slice keeps two copies of every item, at i and i + maxsize in ringbuf. That way the live items are always
+contiguous in ringbuf[head:head+len], so At/FromBack/Items work exactly as for the sliding slice, but a push is
+O(1) with no copying back to the start and no allocation once created.
+Memory is 2 * maxsize rather than MULTIPLIER * maxsize.
+*/
+func NewRingSlice[T any](size int, maxsize int) *Slice[T] {
+	if size > maxsize {
+		size = maxsize
+	}
+	ms := &Slice[T]{
+		isring:     true,
+		ringbuf:    make([]T, 2*maxsize),
+		maxsize:    maxsize,
+		actualsize: size,
+		maxactual:  maxsize,
+	}
+	ms.slice = ms.ringbuf[:size]
+	return ms
+}
+
+// / itemdecoder must return items of type T
+func NewRingSliceFromStore[T any](storename string, fs store.Store, itemdecoder ItemCoder, maxage time.Duration) (ms *Slice[T], isvalid bool) {
+	ms = &Slice[T]{
+		isring:  true,
+		decoder: itemdecoder,
+	}
+	isvalid = fs.Retrieve(storename, maxage, ms)
+	return ms, isvalid
+}
+
+func (p *Slice[T]) pushRing(item T) (first T) {
+	if p.maxsize == 0 {
+		return item
+	}
+	count := len(p.slice)
+	if count == p.maxsize {
+		first = p.slice[0]
+		p.head++
+		if p.head == p.maxsize {
+			p.head = 0
+		}
+	} else {
+		count++
+	}
+	p.slice = p.ringbuf[p.head : p.head+count]
+	p.setRing(count-1, item)
+	p.actualsize = count
+	return first
+}
+
+func (p *Slice[T]) setRing(index int, item T) {
+	pos := (p.head + index) % p.maxsize
+	p.ringbuf[pos] = item
+	p.ringbuf[pos+p.maxsize] = item
+}
+
+func (p *Slice[T]) remRing(index int) {
+	count := len(p.slice)
+	for i := index; i < count-1; i++ {
+		p.setRing(i, p.slice[i+1])
+	}
+	var zero T
+	p.setRing(count-1, zero) /// don't hold onto references
+	p.slice = p.ringbuf[p.head : p.head+count-1]
+	p.actualsize = count - 1
+}
+
+func (p *Slice[T]) dropFrontRing(n int) {
+	count := len(p.slice)
+	var zero T
+	for i := 0; i < n; i++ {
+		p.setRing(i, zero) /// don't hold onto references
+	}
+	p.head = (p.head + n) % p.maxsize
+	p.slice = p.ringbuf[p.head : p.head+count-n]
+	p.actualsize = count - n
+}
+
+// / After a decode, the items are in slice - copy them into a new ring
+func (p *Slice[T]) rebuildRing() {
+	items := p.slice
+	if len(items) > p.maxsize {
+		items = items[len(items)-p.maxsize:]
+	}
+	p.ringbuf = make([]T, 2*p.maxsize)
+	p.head = 0
+	p.slice = p.ringbuf[:len(items)]
+	for i, item := range items {
+		p.setRing(i, item)
+	}
+	p.actualsize = len(items)
+	p.maxactual = p.maxsize
+}
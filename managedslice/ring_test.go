@@ -0,0 +1,114 @@
+package managedslice
+
+import (
+	"github.com/paul-at-nangalan/short-term-store/store"
+	"gotest.tools/v3/assert"
+	"testing"
+	"time"
+)
+
+func TestRingSlice_At(t *testing.T) {
+	s := NewRingSlice[int](0, 3)
+	for i := 0; i < 25; i++ {
+		s.PushAndResize(i + 1)
+	}
+	assert.DeepEqual(t, s.Items(), []int{23, 24, 25})
+	assert.Equal(t, s.FromBack(0), 25)
+	assert.Equal(t, s.FromBack(2), 23)
+}
+
+func TestRingSlice_MatchesSliding(t *testing.T) {
+	ring := NewRingSlice[int](0, 7)
+	sliding := NewSlice[int](0, 7)
+	for i := 0; i < 1000; i++ {
+		assert.Equal(t, ring.PushAndResize(i), sliding.PushAndResize(i), "Mismatch on dropped item at ", i)
+		assert.DeepEqual(t, ring.Items(), sliding.Items())
+	}
+}
+
+func TestRingSlice_RemAndSet(t *testing.T) {
+	s := NewRingSlice[int](0, 6)
+	for i := 0; i < 12; i++ {
+		s.PushAndResize(i + 1)
+	}
+	s.Rem(10)
+	assert.DeepEqual(t, s.Items(), []int{7, 8, 9, 11, 12})
+	for i := 12; i < 14; i++ {
+		s.PushAndResize(i + 1)
+	}
+	assert.DeepEqual(t, s.Items(), []int{8, 9, 11, 12, 13, 14})
+	s.Set(0, 100)
+	/// push enough to wrap right round the ring - the set value must have been written to both copies
+	for i := 0; i < 5; i++ {
+		s.PushAndResize(i)
+	}
+	assert.DeepEqual(t, s.Items(), []int{14, 0, 1, 2, 3, 4})
+	s.Set(5, 99)
+	assert.Equal(t, s.FromBack(0), 99)
+	s.PushAndResize(7)
+	assert.DeepEqual(t, s.Items(), []int{0, 1, 2, 3, 99, 7})
+}
+
+func TestRingSlice_NoAlloc(t *testing.T) {
+	s := NewRingSlice[float64](0, 100)
+	allocs := testing.AllocsPerRun(10000, func() {
+		s.PushAndResize(1.5)
+	})
+	assert.Equal(t, allocs, float64(0), "Ring push should not allocate")
+}
+
+func Test_RingSliceEncodeDecode(t *testing.T) {
+	ms := NewRingSlice[*TestEncDec](0, 20)
+	testdata := make([]TestEncDec, 55)
+	for i := range testdata {
+		testdata[i].x = float64(i) * 0.1
+		testdata[i].val = float64(i) * 0.2
+		ms.PushAndResize(&testdata[i])
+	}
+	fs := store.NewFileStore("/tmp/teststore/")
+	ms.Store("test-ring-slice", fs)
+	time.Sleep(time.Second)
+
+	restored, isvalid := NewRingSliceFromStore[*TestEncDec]("test-ring-slice", fs, &TestEncDec{}, time.Hour)
+	assert.Equal(t, isvalid, true, "Data is marked invalid")
+	assert.Equal(t, restored.Len(), 20, "Mismatch length")
+	for i, data := range testdata[35:] {
+		assert.Equal(t, restored.At(i).x, data.x, "Mismatch on data at ", i)
+	}
+	restored.PushAndResize(&testdata[0])
+	assert.Equal(t, restored.Len(), 20, "Mismatch length after push")
+	assert.Equal(t, restored.At(0).x, testdata[36].x)
+	assert.Equal(t, restored.FromBack(0).x, testdata[0].x)
+}
+
+func BenchmarkSlice_PushAndResize(b *testing.B) {
+	s := NewSlice[float64](0, 10000)
+	for i := 0; i < b.N; i++ {
+		s.PushAndResize(float64(i))
+	}
+}
+
+func BenchmarkRingSlice_PushAndResize(b *testing.B) {
+	s := NewRingSlice[float64](0, 10000)
+	for i := 0; i < b.N; i++ {
+		s.PushAndResize(float64(i))
+	}
+}
+
+func TestRingSlice_DropFront(t *testing.T) {
+	ring := NewRingSlice[int](0, 7)
+	sliding := NewSlice[int](0, 7)
+	for i := 0; i < 1000; i++ {
+		ring.PushAndResize(i)
+		sliding.PushAndResize(i)
+		if i%5 == 0 {
+			ring.DropFront(i % 4)
+			sliding.DropFront(i % 4)
+		}
+		assert.DeepEqual(t, ring.Items(), sliding.Items())
+	}
+	ring.DropFront(100)
+	assert.Equal(t, ring.Len(), 0)
+	ring.PushAndResize(1)
+	assert.DeepEqual(t, ring.Items(), []int{1})
+}
@@ -15,17 +15,26 @@ type ItemCoder interface {
 	Encode(buffer *gob.Encoder)
 }
 
-type Slice struct {
-	slice      []interface{}
-	origslice  []interface{}
+/*
+*
+Slice is a fixed max size window over the most recent items pushed into it. T is the item type - to use the store
+integration, T must implement ItemCoder (or be an interface holding types that do).
+*/
+type Slice[T any] struct {
+	slice      []T
+	origslice  []T
 	maxsize    int
 	maxactual  int
 	actualsize int
 
+	isring  bool
+	ringbuf []T /// see ring.go - slice is always a view into this when isring is set
+	head    int
+
 	decoder ItemCoder
 }
 
-func (p *Slice) Decode(buffer io.Reader) {
+func (p *Slice[T]) Decode(buffer io.Reader) {
 	dec := gob.NewDecoder(buffer)
 	err := dec.Decode(&p.maxsize)
 	handlers.PanicOnError(err)
@@ -36,7 +45,7 @@ func (p *Slice) Decode(buffer io.Reader) {
 	slicelen := int(0)
 	err = dec.Decode(&slicelen)
 	handlers.PanicOnError(err)
-	p.slice = make([]interface{}, slicelen)
+	p.slice = make([]T, slicelen)
 	fmt.Println("Decode slice len ", slicelen)
 	for i := 0; i < slicelen; i++ {
 		item := p.decoder.Decode(dec)
@@ -46,11 +55,18 @@ func (p *Slice) Decode(buffer io.Reader) {
 			log.Panic("Item returned by ItemCoder does not implement the store.Encoder interface. This cannot be the same item that was stored ",
 				item)
 		}
-		p.slice[i] = item
+		typed, ok := item.(T)
+		if !ok {
+			log.Panicf("Item returned by ItemCoder is a %T, which does not match the slice type %T", item, *new(T))
+		}
+		p.slice[i] = typed
+	}
+	if p.isring {
+		p.rebuildRing()
 	}
 }
 
-func (p *Slice) Encode(buffer io.Writer) {
+func (p *Slice[T]) Encode(buffer io.Writer) {
 	enc := gob.NewEncoder(buffer)
 	err := enc.Encode(p.maxsize)
 	handlers.PanicOnError(err)
@@ -62,7 +78,7 @@ func (p *Slice) Encode(buffer io.Writer) {
 	handlers.PanicOnError(err)
 	//fmt.Println("Encode slice len ", len(p.slice))
 	for _, val := range p.slice {
-		val.(ItemCoder).Encode(enc) //// val must be encodable - if not a standard type, then support the gob interface
+		any(val).(ItemCoder).Encode(enc) //// val must be encodable - if not a standard type, then support the gob interface
 	}
 }
 
@@ -70,9 +86,14 @@ const (
 	MULTIPLIER = 3
 )
 
-func NewManagedSlice(size int, maxsize int) *Slice {
-	ms := &Slice{}
-	ms.slice = make([]interface{}, size, maxsize*MULTIPLIER)
+// / Untyped version of NewSlice - items will need type asserting on the way out
+func NewManagedSlice(size int, maxsize int) *Slice[any] {
+	return NewSlice[any](size, maxsize)
+}
+
+func NewSlice[T any](size int, maxsize int) *Slice[T] {
+	ms := &Slice[T]{}
+	ms.slice = make([]T, size, maxsize*MULTIPLIER)
 	ms.origslice = ms.slice[:0] ///this should always point at the original slice
 	ms.maxsize = maxsize
 	ms.actualsize = size
@@ -80,35 +101,47 @@ func NewManagedSlice(size int, maxsize int) *Slice {
 	return ms
 }
 
-func NewManagedSliceFromStore(storename string, fs store.Store, itemdecoder ItemCoder, maxage time.Duration) (ms *Slice, isvalid bool) {
-	ms = &Slice{
+func NewManagedSliceFromStore(storename string, fs store.Store, itemdecoder ItemCoder, maxage time.Duration) (ms *Slice[any], isvalid bool) {
+	return NewSliceFromStore[any](storename, fs, itemdecoder, maxage)
+}
+
+// / itemdecoder must return items of type T
+func NewSliceFromStore[T any](storename string, fs store.Store, itemdecoder ItemCoder, maxage time.Duration) (ms *Slice[T], isvalid bool) {
+	ms = &Slice[T]{
 		decoder: itemdecoder,
 	}
 	isvalid = fs.Retrieve(storename, maxage, ms)
 	return ms, isvalid
 }
 
-func (p *Slice) Store(storename string, fs store.Store) {
+func (p *Slice[T]) Store(storename string, fs store.Store) {
 	fs.Store(storename, p)
 }
 
-func (p *Slice) Set(index int, item interface{}) {
+func (p *Slice[T]) Set(index int, item T) {
+	if p.isring {
+		p.setRing(index, item)
+		return
+	}
 	p.slice[index] = item
 }
-func (p *Slice) At(index int) interface{} {
+func (p *Slice[T]) At(index int) T {
 	return p.slice[index]
 }
-func (p *Slice) FromBack(index int) interface{} {
+func (p *Slice[T]) FromBack(index int) T {
 	return p.slice[len(p.slice)-(index+1)]
 }
-func (p *Slice) Len() int {
+func (p *Slice[T]) Len() int {
 	return len(p.slice)
 }
-func (p *Slice) Items() []interface{} {
+func (p *Slice[T]) Items() []T {
 	return p.slice
 }
 
-func (p *Slice) PushAndResize(item interface{}) (first interface{}) {
+func (p *Slice[T]) PushAndResize(item T) (first T) {
+	if p.isring {
+		return p.pushRing(item)
+	}
 	p.slice = append(p.slice, item)
 	p.actualsize++
 	if len(p.slice) > p.maxsize {
@@ -129,16 +162,56 @@ func (p *Slice) PushAndResize(item interface{}) (first interface{}) {
 	return first
 }
 
-// / Warning - SLOW
-func (p *Slice) Rem(item interface{}) {
+// / Drop the n oldest items (all of them if there are fewer than n)
+func (p *Slice[T]) DropFront(n int) {
+	if n > len(p.slice) {
+		n = len(p.slice)
+	}
+	if n <= 0 {
+		return
+	}
+	if p.isring {
+		p.dropFrontRing(n)
+		return
+	}
+	var zero T
+	for i := 0; i < n; i++ {
+		p.slice[i] = zero /// don't hold onto references
+	}
+	p.slice = p.slice[n:]
+}
+
+/*
+*
+Warning - SLOW. Removes the first item equal to item, compared with ==, so T must be comparable - a slice, map or
+func item (or a struct holding one) panics. Use RemFunc for those.
+*/
+func (p *Slice[T]) Rem(item T) {
+	if !p.remFirst(func(elem T) bool { return any(item) == any(elem) }) {
+		log.Panicln("Trying to remove element that's not in the array ", item)
+	}
+}
+
+// / Warning - SLOW. Removes the first item that match returns true for
+func (p *Slice[T]) RemFunc(match func(elem T) bool) {
+	if !p.remFirst(match) {
+		log.Panicln("Trying to remove element that's not in the array")
+	}
+}
+
+func (p *Slice[T]) remFirst(match func(elem T) bool) (found bool) {
 	strtlen := len(p.slice)
 	for i, elem := range p.slice {
-		if item == elem {
+		if match(elem) {
+			if p.isring {
+				p.remRing(i)
+				return true
+			}
 			copy(p.slice[i:], p.slice[i+1:])
 			p.actualsize--
 			p.slice = p.slice[:strtlen-1]
-			return
+			return true
 		}
 	}
-	log.Panicln("Trying to remove element that's not in the array ", item)
+	return false
 }
@@ -11,7 +11,7 @@ import (
 	"time"
 )
 
-func test(s *Slice, expect []int, t *testing.T) {
+func test(s *Slice[any], expect []int, t *testing.T) {
 	for i := 0; i < s.Len(); i++ {
 		if s.At(i) != expect[i] {
 			t.Error("Mismatch at ", i, s.At(i), " != ", expect[i])
@@ -150,3 +150,62 @@ func Test_SliceEncodeDecode(t *testing.T) {
 		assert.Equal(t, retrieved.(*TestEncDec).val, data.val, "Mismatch on data at ", i)
 	}
 }
+
+func TestSlice_Typed(t *testing.T) {
+	s := NewSlice[float64](0, 4)
+	for i := 0; i < 50; i++ {
+		s.PushAndResize(float64(i) * 0.5)
+	}
+	assert.Equal(t, s.Len(), 4, "Mismatch length")
+	assert.Equal(t, s.FromBack(0), 24.5, "Mismatch last value")
+	assert.Equal(t, s.At(0), 23.0, "Mismatch first value")
+	s.Rem(24.0)
+	assert.DeepEqual(t, s.Items(), []float64{23.0, 23.5, 24.5})
+
+	/// slices can't be compared with == - they need RemFunc
+	lists := NewSlice[[]int](0, 4)
+	lists.PushAndResize([]int{1})
+	lists.PushAndResize([]int{2, 3})
+	lists.RemFunc(func(elem []int) bool { return len(elem) == 2 })
+	assert.DeepEqual(t, lists.Items(), [][]int{{1}})
+}
+
+func Test_TypedSliceEncodeDecode(t *testing.T) {
+	ms := NewSlice[*TestEncDec](0, 20)
+	testdata := make([]TestEncDec, 50)
+	for i := range testdata {
+		testdata[i].x = float64(i) * 0.3
+		testdata[i].val = float64(i) * 0.4
+		ms.PushAndResize(&testdata[i])
+	}
+	fs := store.NewFileStore("/tmp/teststore/")
+	ms.Store("test-typed-managed-slice", fs)
+	time.Sleep(time.Second)
+
+	restored, isvalid := NewSliceFromStore[*TestEncDec]("test-typed-managed-slice", fs, &TestEncDec{}, time.Hour)
+	assert.Equal(t, isvalid, true, "Data is marked invalid")
+	assert.Equal(t, restored.Len(), 20, "Mismatch length")
+	for i, data := range testdata[30:] {
+		assert.Equal(t, restored.At(i).x, data.x, "Mismatch on data at ", i)
+		assert.Equal(t, restored.At(i).val, data.val, "Mismatch on data at ", i)
+	}
+}
+
+func TestSlice_DropFront(t *testing.T) {
+	s := NewSlice[int](0, 5)
+	for i := 0; i < 5; i++ {
+		s.PushAndResize(i)
+	}
+	s.DropFront(2)
+	assert.DeepEqual(t, s.Items(), []int{2, 3, 4})
+	assert.Equal(t, s.FromBack(2), 2)
+	s.DropFront(0)
+	assert.Equal(t, s.Len(), 3)
+	/// keep pushing past a reallocation
+	for i := 5; i < 50; i++ {
+		s.PushAndResize(i)
+	}
+	assert.DeepEqual(t, s.Items(), []int{45, 46, 47, 48, 49})
+	s.DropFront(10)
+	assert.Equal(t, s.Len(), 0)
+}
@@ -0,0 +1,85 @@
+package managedslice
+
+import (
+	"github.com/paul-at-nangalan/short-term-store/store"
+	"sync"
+)
+
+/*
+*
+SyncSlice is a managed slice that is safe to push to and read from on different goroutines.
+There's no Items() as the returned slice would be shared with the writer - use Copy instead.
+*/
+type SyncSlice[T any] struct {
+	lock  sync.RWMutex
+	slice *Slice[T]
+}
+
+func NewSyncSlice[T any](slice *Slice[T]) *SyncSlice[T] {
+	return &SyncSlice[T]{
+		slice: slice,
+	}
+}
+
+func (p *SyncSlice[T]) PushAndResize(item T) (first T) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.slice.PushAndResize(item)
+}
+
+func (p *SyncSlice[T]) Set(index int, item T) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.slice.Set(index, item)
+}
+
+func (p *SyncSlice[T]) Rem(item T) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.slice.Rem(item)
+}
+
+func (p *SyncSlice[T]) RemFunc(match func(elem T) bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.slice.RemFunc(match)
+}
+
+func (p *SyncSlice[T]) DropFront(n int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.slice.DropFront(n)
+}
+
+func (p *SyncSlice[T]) At(index int) T {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.slice.At(index)
+}
+
+func (p *SyncSlice[T]) FromBack(index int) T {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.slice.FromBack(index)
+}
+
+func (p *SyncSlice[T]) Len() int {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.slice.Len()
+}
+
+func (p *SyncSlice[T]) Copy() []T {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	items := make([]T, p.slice.Len())
+	copy(items, p.slice.Items())
+	return items
+}
+
+// / The store encodes the data before returning, so holding the read lock here is enough
+func (p *SyncSlice[T]) Store(storename string, fs store.Store) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	p.slice.Store(storename, fs)
+}
@@ -0,0 +1,40 @@
+package managedslice
+
+import (
+	"gotest.tools/v3/assert"
+	"sync"
+	"testing"
+)
+
+// / run with -race
+func TestSyncSlice_Concurrent(t *testing.T) {
+	s := NewSyncSlice(NewRingSlice[int](0, 50))
+	wg := sync.WaitGroup{}
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10000; j++ {
+				s.PushAndResize(j)
+			}
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10000; j++ {
+				if s.Len() > 0 {
+					s.FromBack(0)
+				}
+				items := s.Copy()
+				if len(items) > 50 {
+					t.Error("Too many items ", len(items))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, s.Len(), 50)
+	assert.Equal(t, len(s.Copy()), 50)
+}
@@ -0,0 +1,215 @@
+package backtest
+
+import (
+	"fmt"
+	"github.com/paul-at-nangalan/signals/signals"
+	"github.com/paul-at-nangalan/signals/signals/combinator"
+	"gonum.org/v1/gonum/stat"
+	"math"
+	"time"
+)
+
+type Tick struct {
+	Time  time.Time
+	Price float64
+}
+
+// / A signal that can be fed prices - use FeedSigCurve/FeedSigPercentile to wrap the existing signals.
+// / An error from AddSample stops the replay
+type Feeder interface {
+	signals.Signal
+	AddSample(val float64, t time.Time) error
+}
+
+type curveFeeder struct {
+	*signals.SigCurve
+}
+
+func (p curveFeeder) AddSample(val float64, t time.Time) error {
+	return p.AddVarianceSample(val, t)
+}
+
+func FeedSigCurve(sig *signals.SigCurve) Feeder {
+	return curveFeeder{sig}
+}
+
+type percentileFeeder struct {
+	*signals.SigPercentile
+}
+
+func (p percentileFeeder) AddSample(val float64, t time.Time) error {
+	p.AddDataAt(val, t)
+	return nil
+}
+
+func FeedSigPercentile(sig *signals.SigPercentile) Feeder {
+	return percentileFeeder{sig}
+}
+
+type Trade struct {
+	Side       signals.Direction /// Buy is a long position, Sell a short
+	EntryTime  time.Time
+	EntryPrice float64
+	ExitTime   time.Time
+	ExitPrice  float64
+	PnL        float64 /// per unit traded
+	Return     float64 /// PnL / EntryPrice
+}
+
+type Result struct {
+	Trades      []Trade
+	PnL         float64
+	HitRate     float64 /// fraction of trades with a positive PnL
+	MaxDrawdown float64 /// largest peak to trough fall in the marked to market PnL
+	Sharpe      float64 /// mean / std dev of the per trade returns - not annualised
+}
+
+/*
+*
+AllowShort - if false a sell signal only closes a long position, otherwise it also opens a short
+*/
+type Config struct {
+	AllowShort bool
+}
+
+/*
+*
+Engine replays a price series through one or more signals. Every tick is fed to all the feeds, then the trigger is
+checked: buy opens a long (closing any short), sell closes a long (and opens a short if allowed).
+Positions are always 1 unit, and anything still open at the end is closed on the last tick.
+Any feed with a SetClock method is switched to a clock that follows the tick times, so ageing and saving behave as
+they would have live. A trigger with an Update method (e.g. a combinator) is updated after the feeds on every tick.
+*/
+type Engine struct {
+	feeds      []Feeder
+	trigger    signals.Signal
+	allowshort bool
+}
+
+// / If trigger is nil, the feeds are combined with an AND
+func NewEngine(cfg Config, trigger signals.Signal, feeds ...Feeder) *Engine {
+	if trigger == nil {
+		sigs := make([]signals.Signal, len(feeds))
+		for i, feed := range feeds {
+			sigs[i] = feed
+		}
+		trigger = combinator.NewAnd(sigs...)
+	}
+	return &Engine{
+		feeds:      feeds,
+		trigger:    trigger,
+		allowshort: cfg.AllowShort,
+	}
+}
+
+type position struct {
+	side  signals.Direction
+	entry Tick
+}
+
+func (p *position) pnl(price float64) float64 {
+	switch p.side {
+	case signals.Buy:
+		return price - p.entry.Price
+	case signals.Sell:
+		return p.entry.Price - price
+	}
+	return 0
+}
+
+func (p *Engine) Run(ticks []Tick) (Result, error) {
+	res := Result{
+		Trades: make([]Trade, 0),
+	}
+	clock := signals.NewManualClock(time.Time{})
+	for _, feed := range p.feeds {
+		if clocked, ok := feed.(interface{ SetClock(signals.Clock) }); ok {
+			clocked.SetClock(clock)
+		}
+	}
+	pos := position{side: signals.Neutral}
+	realised := float64(0)
+	peak := float64(0)
+
+	closepos := func(tick Tick) {
+		pnl := pos.pnl(tick.Price)
+		res.Trades = append(res.Trades, Trade{
+			Side:       pos.side,
+			EntryTime:  pos.entry.Time,
+			EntryPrice: pos.entry.Price,
+			ExitTime:   tick.Time,
+			ExitPrice:  tick.Price,
+			PnL:        pnl,
+			Return:     pnl / pos.entry.Price,
+		})
+		realised += pnl
+		pos = position{side: signals.Neutral}
+	}
+
+	for i, tick := range ticks {
+		if i > 0 && tick.Time.Before(ticks[i-1].Time) {
+			return res, fmt.Errorf("ticks are out of order at %d: %v is before %v", i, tick.Time, ticks[i-1].Time)
+		}
+		clock.Set(tick.Time)
+		for j, feed := range p.feeds {
+			if err := feed.AddSample(tick.Price, tick.Time); err != nil {
+				return res, fmt.Errorf("feed %d failed on tick %d at %v: %w", j, i, tick.Time, err)
+			}
+		}
+		if updater, ok := p.trigger.(interface{ Update() }); ok {
+			updater.Update()
+		}
+		switch signals.DirectionOf(p.trigger) {
+		case signals.Buy:
+			if pos.side == signals.Sell {
+				closepos(tick)
+			}
+			if pos.side == signals.Neutral {
+				pos = position{side: signals.Buy, entry: tick}
+			}
+		case signals.Sell:
+			if pos.side == signals.Buy {
+				closepos(tick)
+			}
+			if pos.side == signals.Neutral && p.allowshort {
+				pos = position{side: signals.Sell, entry: tick}
+			}
+		}
+		equity := realised + pos.pnl(tick.Price)
+		if equity > peak {
+			peak = equity
+		}
+		if peak-equity > res.MaxDrawdown {
+			res.MaxDrawdown = peak - equity
+		}
+	}
+	if pos.side != signals.Neutral {
+		closepos(ticks[len(ticks)-1])
+	}
+	res.PnL = realised
+	res.summarise()
+	return res, nil
+}
+
+func (p *Result) summarise() {
+	if len(p.Trades) == 0 {
+		return
+	}
+	wins := 0
+	returns := make([]float64, len(p.Trades))
+	for i, trade := range p.Trades {
+		if trade.PnL > 0 {
+			wins++
+		}
+		returns[i] = trade.Return
+	}
+	p.HitRate = float64(wins) / float64(len(p.Trades))
+	if len(returns) < 2 {
+		return
+	}
+	mean, stddev := stat.MeanStdDev(returns, nil)
+	if stddev == 0 || math.IsNaN(stddev) {
+		return
+	}
+	p.Sharpe = mean / stddev
+}
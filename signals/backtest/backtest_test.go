@@ -0,0 +1,133 @@
+package backtest
+
+import (
+	"errors"
+	"github.com/paul-at-nangalan/short-term-store/store"
+	"github.com/paul-at-nangalan/signals/signals"
+	perfstats "github.com/paul-at-nangalan/stats/stats"
+	"gotest.tools/v3/assert"
+	"math"
+	"testing"
+	"time"
+)
+
+// / buys below buyat, sells above sellat
+type thresholdFeeder struct {
+	buyat, sellat float64
+	last          float64
+}
+
+func (p *thresholdFeeder) AddSample(val float64, t time.Time) error {
+	p.last = val
+	return nil
+}
+func (p *thresholdFeeder) SigBuy() bool                       { return p.last <= p.buyat }
+func (p *thresholdFeeder) SigSell() bool                      { return p.last >= p.sellat }
+func (p *thresholdFeeder) GetStatsCounters() []perfstats.Stat { return nil }
+func (p *thresholdFeeder) Plot()                              {}
+func (p *thresholdFeeder) SetupStorage(storename string, fs store.Store, howoftentosave time.Duration) {
+}
+
+func genTicks(prices ...float64) []Tick {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ticks := make([]Tick, len(prices))
+	for i, price := range prices {
+		ticks[i] = Tick{Time: start.Add(time.Duration(i) * time.Minute), Price: price}
+	}
+	return ticks
+}
+
+func TestEngine_LongOnly(t *testing.T) {
+	feed := &thresholdFeeder{buyat: 95, sellat: 105}
+	engine := NewEngine(Config{}, nil, feed)
+	res, err := engine.Run(genTicks(100, 95, 90, 100, 106, 100, 94, 98, 80, 90, 110, 100))
+	assert.NilError(t, err)
+	/// long at 95 -> 106, long at 94 -> 110
+	assert.Equal(t, len(res.Trades), 2)
+	assert.Equal(t, res.Trades[0].EntryPrice, 95.0)
+	assert.Equal(t, res.Trades[0].ExitPrice, 106.0)
+	assert.Equal(t, res.Trades[1].EntryPrice, 94.0)
+	assert.Equal(t, res.Trades[1].ExitPrice, 110.0)
+	assert.Equal(t, res.PnL, 27.0)
+	assert.Equal(t, res.HitRate, 1.0)
+	/// marked to market, the peak is 11 + 4 with the 94 long at 98, then it falls to 11 - 14 at 80
+	assert.Equal(t, res.MaxDrawdown, 18.0)
+	if res.Sharpe <= 0 {
+		t.Error("Expected a positive sharpe ratio ", res.Sharpe)
+	}
+}
+
+func TestEngine_Short(t *testing.T) {
+	feed := &thresholdFeeder{buyat: 95, sellat: 105}
+	engine := NewEngine(Config{AllowShort: true}, feed, feed)
+	res, err := engine.Run(genTicks(106, 100, 94, 100, 110, 112))
+	assert.NilError(t, err)
+	/// short 106 -> 94, long 94 -> 110, short 110 -> closed at the end on 112
+	assert.Equal(t, len(res.Trades), 3)
+	assert.Equal(t, res.Trades[0].Side, signals.Sell)
+	assert.Equal(t, res.Trades[0].PnL, 12.0)
+	assert.Equal(t, res.Trades[1].Side, signals.Buy)
+	assert.Equal(t, res.Trades[1].PnL, 16.0)
+	assert.Equal(t, res.Trades[2].PnL, -2.0)
+	assert.Equal(t, res.PnL, 26.0)
+	assert.Equal(t, res.HitRate, 2.0/3.0)
+	assert.Equal(t, res.MaxDrawdown, 2.0)
+}
+
+func TestEngine_OutOfOrder(t *testing.T) {
+	ticks := genTicks(1, 2, 3)
+	ticks[1].Time, ticks[2].Time = ticks[2].Time, ticks[1].Time
+	_, err := NewEngine(Config{}, nil, &thresholdFeeder{}).Run(ticks)
+	assert.ErrorContains(t, err, "out of order")
+}
+
+func TestEngine_SigPercentile(t *testing.T) {
+	sig := signals.NewSigPercentile(0.2, 0.8, 200, time.Hour)
+	prices := make([]float64, 3000)
+	for i := range prices {
+		prices[i] = 100 + 10*math.Sin(float64(i)/50)
+	}
+	res, err := NewEngine(Config{}, nil, FeedSigPercentile(sig)).Run(genTicks(prices...))
+	assert.NilError(t, err)
+	if len(res.Trades) == 0 {
+		t.Fatal("Expected some trades on a sine wave")
+	}
+	if res.PnL <= 0 || res.HitRate < 0.9 {
+		t.Error("Buying low and selling high on a sine wave should make money ", res.PnL, res.HitRate)
+	}
+}
+
+type clockedFeeder struct {
+	thresholdFeeder
+	clock signals.Clock
+	seen  []time.Time
+}
+
+func (p *clockedFeeder) SetClock(clock signals.Clock) { p.clock = clock }
+func (p *clockedFeeder) AddSample(val float64, t time.Time) error {
+	p.seen = append(p.seen, p.clock.Now())
+	return nil
+}
+
+func TestEngine_ReplayClock(t *testing.T) {
+	feed := &clockedFeeder{}
+	ticks := genTicks(1, 2, 3)
+	_, err := NewEngine(Config{}, nil, feed).Run(ticks)
+	assert.NilError(t, err)
+	assert.Equal(t, len(feed.seen), 3)
+	for i, tick := range ticks {
+		assert.Equal(t, feed.seen[i], tick.Time, "Clock should follow the tick times")
+	}
+}
+
+func TestEngine_FeedError(t *testing.T) {
+	sig, err := signals.NewSigCurveFromConfig(signals.SigCurveConfig{
+		NumSamples: 1000, MinDataPoints: 900, MinSlope: 0.35, Window: 10, MinRSqrd: 0.45,
+		BadSamples: signals.BadSampleError,
+	})
+	assert.NilError(t, err)
+	ticks := genTicks(1, 2, math.NaN(), 4)
+	_, err = NewEngine(Config{}, nil, FeedSigCurve(sig)).Run(ticks)
+	assert.Assert(t, errors.Is(err, signals.ErrBadSample), err)
+	assert.ErrorContains(t, err, "tick 2")
+}
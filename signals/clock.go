@@ -0,0 +1,47 @@
+package signals
+
+import (
+	"sync"
+	"time"
+)
+
+// / Anything that needs the current time gets it from a Clock, so replays can run faster than real time
+type Clock interface {
+	Now() time.Time
+}
+
+type WallClock struct{}
+
+func (WallClock) Now() time.Time {
+	return time.Now()
+}
+
+// / A clock that only moves when told to - for replaying historical data and for tests
+type ManualClock struct {
+	lock sync.Mutex
+	t    time.Time
+}
+
+func NewManualClock(t time.Time) *ManualClock {
+	return &ManualClock{
+		t: t,
+	}
+}
+
+func (p *ManualClock) Now() time.Time {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.t
+}
+
+func (p *ManualClock) Set(t time.Time) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.t = t
+}
+
+func (p *ManualClock) Advance(d time.Duration) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.t = p.t.Add(d)
+}
@@ -0,0 +1,65 @@
+package signals
+
+import (
+	"golang.org/x/exp/rand"
+	"gotest.tools/v3/assert"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestManualClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewManualClock(start)
+	assert.Equal(t, clock.Now(), start)
+	clock.Advance(time.Hour)
+	assert.Equal(t, clock.Now(), start.Add(time.Hour))
+	clock.Set(start)
+	assert.Equal(t, clock.Now(), start)
+}
+
+// / Same as TestSigPercentile_prune, but without having to wait for the data to age
+func TestSigPercentile_pruneManualClock(t *testing.T) {
+	clock := NewManualClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	sig, err := NewSigPercentileFromConfig(SigPercentileConfig{
+		BuyBelow: 0.25, SellAbove: 0.75, MinData: 1000, TargetAge: time.Hour, Clock: clock,
+	})
+	assert.NilError(t, err)
+	src := rand.NewSource(3)
+	lower := 100.0
+	upper := 200.0
+	fillSigFrom(src, sig, 3000, lower, upper)
+	clock.Advance(2 * time.Hour)
+	fillSigFrom(src, sig, 3000, lower+12, upper-22)
+	sig.prune()
+	for _, bin := range sig.bins {
+		if bin.upperval < lower+12 {
+			t.Error("Prune failed to clear out the lower ranges ", bin)
+		}
+		if bin.lowerval > upper-22 {
+			t.Error("Prune failed to clear out upper ranges ", bin)
+		}
+	}
+
+	/// nothing is old enough to prune if the clock doesn't move
+	numbins := len(sig.bins)
+	fillSigFrom(src, sig, 3000, lower+20, upper-30)
+	sig.prune()
+	assert.Equal(t, len(sig.bins), numbins, "Nothing should have been pruned")
+}
+
+func TestSigCurve_SaveManualClock(t *testing.T) {
+	clock := NewManualClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	sig := NewSigCurve(1000, 900, 0.35, 10, 0.45)
+	sig.SetClock(clock)
+	fs := newMemStore()
+	sig.SetupStorage("clock-curve", fs, time.Minute)
+	for i := 0; i < 100; i++ {
+		sig.AddVarianceSample(math.Sin(float64(i)/100), clock.Now())
+	}
+	/// the first sample saved, then nothing until a minute has passed
+	assert.Equal(t, sig.lastsaved, clock.Now())
+	clock.Advance(time.Minute)
+	sig.AddVarianceSample(1, clock.Now())
+	assert.Equal(t, sig.lastsaved, clock.Now())
+}
@@ -0,0 +1,209 @@
+package combinator
+
+import (
+	"fmt"
+	"github.com/paul-at-nangalan/short-term-store/store"
+	"github.com/paul-at-nangalan/signals/signals"
+	perfstats "github.com/paul-at-nangalan/stats/stats"
+	"time"
+)
+
+type Rule int
+
+const (
+	RuleAnd Rule = iota
+	RuleOr
+	RuleNOfM
+	RuleWeighted
+)
+
+/*
+*
+Combined wraps a number of signals and signals buy/sell based on a rule applied to them all.
+It is itself a signals.Signal so it can be nested, e.g. an AND of an OR.
+Feeding data in is still done on the underlying signals - Combined just reads them, so call Update after feeding
+them for the buy/sell counters to count.
+*/
+type Combined struct {
+	sigs []signals.Signal
+	rule Rule
+
+	n         int       /// for N of M
+	weights   []float64 /// for weighted vote
+	threshold float64
+
+	lastbuy      bool /// as of the last Update
+	lastsell     bool
+	buys         int64
+	sells        int64
+	statsbuysig  *perfstats.Counter
+	statssellsig *perfstats.Counter
+}
+
+func newCombined(rule Rule, sigs []signals.Signal) *Combined {
+	p := &Combined{
+		sigs: sigs,
+		rule: rule,
+	}
+	p.setupStats("")
+	return p
+}
+
+// / Signal only when all of the signals agree
+func NewAnd(sigs ...signals.Signal) *Combined {
+	return newCombined(RuleAnd, sigs)
+}
+
+// / Signal when any of the signals signals. If one says buy and another sell, both SigBuy and SigSell will be true.
+func NewOr(sigs ...signals.Signal) *Combined {
+	return newCombined(RuleOr, sigs)
+}
+
+// / Signal when at least n of the signals agree
+func NewNOfM(n int, sigs ...signals.Signal) (*Combined, error) {
+	if n <= 0 || n > len(sigs) {
+		return nil, fmt.Errorf("n must be between 1 and the number of signals %d, got %d", len(sigs), n)
+	}
+	p := newCombined(RuleNOfM, sigs)
+	p.n = n
+	return p, nil
+}
+
+/*
+*
+Each signal votes +weight for buy, -weight for sell and 0 if it has no clear direction.
+Signal buy if the total is >= threshold, sell if it's <= -threshold.
+*/
+func NewWeightedVote(weights []float64, threshold float64, sigs ...signals.Signal) (*Combined, error) {
+	if len(weights) != len(sigs) {
+		return nil, fmt.Errorf("need one weight per signal, got %d weights for %d signals", len(weights), len(sigs))
+	}
+	if threshold <= 0 {
+		return nil, fmt.Errorf("threshold must be positive, got %v", threshold)
+	}
+	p := newCombined(RuleWeighted, sigs)
+	p.weights = weights
+	p.threshold = threshold
+	return p, nil
+}
+
+func (p *Combined) count(sig func(signals.Signal) bool) int {
+	count := 0
+	for _, s := range p.sigs {
+		if sig(s) {
+			count++
+		}
+	}
+	return count
+}
+
+func (p *Combined) vote() float64 {
+	total := float64(0)
+	for i, s := range p.sigs {
+		switch signals.DirectionOf(s) {
+		case signals.Buy:
+			total += p.weights[i]
+		case signals.Sell:
+			total -= p.weights[i]
+		}
+	}
+	return total
+}
+
+func (p *Combined) check(sig func(signals.Signal) bool, weightedsign float64) bool {
+	if len(p.sigs) == 0 {
+		return false
+	}
+	switch p.rule {
+	case RuleAnd:
+		return p.count(sig) == len(p.sigs)
+	case RuleOr:
+		return p.count(sig) > 0
+	case RuleNOfM:
+		return p.count(sig) >= p.n
+	case RuleWeighted:
+		return p.vote()*weightedsign >= p.threshold
+	}
+	return false
+}
+
+func (p *Combined) SigBuy() bool {
+	return p.check(signals.Signal.SigBuy, 1)
+}
+
+func (p *Combined) SigSell() bool {
+	return p.check(signals.Signal.SigSell, -1)
+}
+
+/*
+*
+Re-evaluate the rule - call after feeding data to the underlying signals. Combined has no data of its own, so this is
+where a buy or sell is counted, when it starts rather than every time it's read. Nested Combineds are updated first.
+*/
+func (p *Combined) Update() {
+	for _, s := range p.sigs {
+		if nested, ok := s.(*Combined); ok {
+			nested.Update()
+		}
+	}
+	buy := p.SigBuy()
+	sell := p.SigSell()
+	if buy && !p.lastbuy {
+		p.buys++
+		p.statsbuysig.Inc()
+	}
+	if sell && !p.lastsell {
+		p.sells++
+		p.statssellsig.Inc()
+	}
+	p.lastbuy = buy
+	p.lastsell = sell
+}
+
+func (p *Combined) setupStats(prefix string) {
+	p.statsbuysig = perfstats.NewCounter(prefix + "combined-buy-signalled")
+	p.statssellsig = perfstats.NewCounter(prefix + "combined-sell-signalled")
+}
+
+/*
+*
+Put prefix in front of the combined counter names, and prefix-<index>- in front of the underlying signals' counters
+(if they support it), the same way SetupStorage names them. This replaces the counters, so the counts start again -
+call it before registering them with the stats, if at all. The underlying signals are left alone unless this is called.
+*/
+func (p *Combined) SetStatsPrefix(prefix string) {
+	p.setupStats(prefix)
+	for i, s := range p.sigs {
+		if prefixer, ok := s.(signals.StatsPrefixer); ok {
+			prefixer.SetStatsPrefix(fmt.Sprint(prefix, i, "-"))
+		}
+	}
+}
+
+// / The combined buy/sell counters, then the stats of all the underlying signals
+func (p *Combined) GetStatsCounters() []perfstats.Stat {
+	stats := []perfstats.Stat{p.statsbuysig, p.statssellsig}
+	for _, s := range p.sigs {
+		stats = append(stats, s.GetStatsCounters()...)
+	}
+	return stats
+}
+
+func (p *Combined) Plot() {
+	for i, s := range p.sigs {
+		fmt.Println("Signal ", i)
+		s.Plot()
+	}
+}
+
+// / Each signal is stored under storename-<index>, so the order of the signals must be the same when reloading
+func (p *Combined) SetupStorage(storename string, fs store.Store, howoftentosave time.Duration) {
+	for i, s := range p.sigs {
+		s.SetupStorage(fmt.Sprint(storename, "-", i), fs, howoftentosave)
+	}
+}
+
+var (
+	_ signals.Signal        = &Combined{}
+	_ signals.StatsPrefixer = &Combined{}
+)
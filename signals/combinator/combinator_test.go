@@ -0,0 +1,130 @@
+package combinator
+
+import (
+	"github.com/paul-at-nangalan/short-term-store/store"
+	"github.com/paul-at-nangalan/signals/signals"
+	perfstats "github.com/paul-at-nangalan/stats/stats"
+	"gotest.tools/v3/assert"
+	"testing"
+	"time"
+)
+
+type fixedSignal struct {
+	buy, sell   bool
+	storagename string
+	statsprefix string
+}
+
+func (p *fixedSignal) SigBuy() bool  { return p.buy }
+func (p *fixedSignal) SigSell() bool { return p.sell }
+func (p *fixedSignal) GetStatsCounters() []perfstats.Stat {
+	return []perfstats.Stat{perfstats.NewCounter("fixed")}
+}
+func (p *fixedSignal) SetStatsPrefix(prefix string) {
+	p.statsprefix = prefix
+}
+func (p *fixedSignal) Plot() {}
+func (p *fixedSignal) SetupStorage(storename string, fs store.Store, howoftentosave time.Duration) {
+	p.storagename = storename
+}
+
+func buy() *fixedSignal     { return &fixedSignal{buy: true} }
+func sell() *fixedSignal    { return &fixedSignal{sell: true} }
+func neutral() *fixedSignal { return &fixedSignal{} }
+
+func TestAndOr(t *testing.T) {
+	and := NewAnd(buy(), buy(), neutral())
+	assert.Equal(t, and.SigBuy(), false, "AND should need all signals")
+	and = NewAnd(buy(), buy())
+	assert.Equal(t, and.SigBuy(), true, "AND of all buys should buy")
+	assert.Equal(t, and.SigSell(), false)
+
+	or := NewOr(neutral(), sell(), neutral())
+	assert.Equal(t, or.SigSell(), true, "OR should sell on any sell")
+	assert.Equal(t, or.SigBuy(), false)
+
+	/// nested
+	nested := NewAnd(NewOr(neutral(), buy()), buy())
+	assert.Equal(t, signals.DirectionOf(nested), signals.Buy)
+
+	assert.Equal(t, NewAnd().SigBuy(), false, "Empty combinator shouldn't signal")
+}
+
+func TestNOfM(t *testing.T) {
+	_, err := NewNOfM(4, buy(), buy(), buy())
+	assert.ErrorContains(t, err, "n must be")
+
+	c, err := NewNOfM(2, buy(), sell(), buy())
+	assert.NilError(t, err)
+	assert.Equal(t, c.SigBuy(), true)
+	assert.Equal(t, c.SigSell(), false)
+	c, err = NewNOfM(2, buy(), sell(), neutral())
+	assert.NilError(t, err)
+	assert.Equal(t, signals.DirectionOf(c), signals.Neutral)
+}
+
+func TestWeightedVote(t *testing.T) {
+	_, err := NewWeightedVote([]float64{1}, 1, buy(), buy())
+	assert.ErrorContains(t, err, "one weight per signal")
+
+	c, err := NewWeightedVote([]float64{3, 1, 1}, 2, buy(), sell(), neutral())
+	assert.NilError(t, err)
+	assert.Equal(t, c.SigBuy(), true, "3 - 1 should reach the threshold of 2")
+	assert.Equal(t, c.SigSell(), false)
+
+	c, err = NewWeightedVote([]float64{1, 3, 1}, 2, buy(), sell(), sell())
+	assert.NilError(t, err)
+	assert.Equal(t, c.SigSell(), true, "-1 + 3 + 1 should reach the threshold of 2")
+	assert.Equal(t, c.SigBuy(), false)
+
+	/// a signal with both set has no direction so doesn't vote
+	c, err = NewWeightedVote([]float64{3, 1}, 1, &fixedSignal{buy: true, sell: true}, buy())
+	assert.NilError(t, err)
+	assert.Equal(t, c.SigBuy(), true)
+}
+
+func TestCombined_StatsAndStorage(t *testing.T) {
+	a := buy()
+	b := sell()
+	c := NewOr(a, NewAnd(b))
+	assert.Equal(t, len(c.GetStatsCounters()), 6, "Expected the combined counters and the stats of all nested signals")
+	assert.Equal(t, a.statsprefix, "", "Combining shouldn't touch the signals' counters")
+	c.SetStatsPrefix("")
+	assert.Equal(t, a.statsprefix, "0-")
+	assert.Equal(t, b.statsprefix, "1-0-")
+	c.SetupStorage("combined", nil, time.Second)
+	assert.Equal(t, a.storagename, "combined-0")
+	assert.Equal(t, b.storagename, "combined-1-0")
+}
+
+func TestCombined_CountsFirings(t *testing.T) {
+	a := buy()
+	b := neutral()
+	c := NewAnd(a, b)
+	c.Update()
+	assert.Equal(t, c.SigBuy(), false)
+	b.buy = true
+	assert.Equal(t, c.SigBuy(), true)
+	c.SigBuy()
+	assert.Equal(t, c.buys, int64(0), "Reading the signal shouldn't count it")
+	c.Update()
+	c.Update()
+	assert.Equal(t, c.buys, int64(1), "Expected the buy to be counted once while it lasts")
+	b.buy = false
+	c.Update()
+	b.buy = true
+	c.Update()
+	assert.Equal(t, c.buys, int64(2), "Expected a new buy to be counted")
+	assert.Equal(t, c.sells, int64(0))
+
+	/// nested ones are updated by the outer one
+	inner := NewOr(sell())
+	outer := NewOr(inner)
+	outer.Update()
+	assert.Equal(t, outer.sells, int64(1))
+	assert.Equal(t, inner.sells, int64(1))
+
+	c.SetStatsPrefix("outer-")
+	assert.Equal(t, a.statsprefix, "outer-0-")
+	assert.Equal(t, b.statsprefix, "outer-1-")
+}
@@ -0,0 +1,168 @@
+package signals
+
+import (
+	"fmt"
+	"time"
+)
+
+/*
+*
+Band is a threshold with hysteresis. The signal turns on when the value goes past Enter and stays on until the value
+goes back past Exit. Below says which side of Enter turns it on - e.g. a buy on a low percentile would be
+Band{Enter: 0.2, Exit: 0.3, Below: true}, a buy on a steep slope Band{Enter: 0.35, Exit: 0.3}.
+A zero Band is off - it never turns the signal on, so e.g. a buy-only signal just sets Buy.
+*/
+type Band struct {
+	Enter float64
+	Exit  float64
+	Below bool
+}
+
+func (b Band) isSet() bool {
+	return b != Band{}
+}
+
+func (b Band) entered(val float64) bool {
+	if !b.isSet() {
+		return false
+	}
+	if b.Below {
+		return val < b.Enter
+	}
+	return val > b.Enter
+}
+
+func (b Band) exited(val float64) bool {
+	if b.Below {
+		return val > b.Exit
+	}
+	return val < b.Exit
+}
+
+func (b Band) validate() error {
+	if b.Below && b.Exit < b.Enter || !b.Below && b.Exit > b.Enter {
+		return fmt.Errorf("the exit threshold %v must be on the far side of the enter threshold %v", b.Exit, b.Enter)
+	}
+	return nil
+}
+
+/*
+*
+DebounceConfig stops a signal chattering on noisy data.
+Buy and Sell - the enter/exit thresholds. If only one is set, the other side never signals. If neither is set, the debouncer is fed a direction rather than a value
+(see UpdateDirection), so only Confirm and Cooldown apply.
+Confirm - how many samples in a row must want the signal before it turns on (0 is the same as 1)
+Cooldown - the minimum time from a signal last being on to the opposite signal turning on
+*/
+type DebounceConfig struct {
+	Buy      Band
+	Sell     Band
+	Confirm  int
+	Cooldown time.Duration
+}
+
+func (c DebounceConfig) hasBands() bool {
+	return c.Buy.isSet() || c.Sell.isSet()
+}
+
+func (c DebounceConfig) Validate() error {
+	if c.Confirm < 0 || c.Cooldown < 0 {
+		return fmt.Errorf("debounce confirm and cooldown can't be negative, got %d and %v", c.Confirm, c.Cooldown)
+	}
+	if err := c.Buy.validate(); err != nil {
+		return fmt.Errorf("buy band: %w", err)
+	}
+	if err := c.Sell.validate(); err != nil {
+		return fmt.Errorf("sell band: %w", err)
+	}
+	return nil
+}
+
+/*
+*
+Debouncer turns a stream of values (or raw directions) into a direction that only changes once it's been confirmed,
+with hysteresis and a cooldown between opposite signals.
+It's not goroutine safe - it's meant to be owned by a signal.
+*/
+type Debouncer struct {
+	cfg DebounceConfig
+
+	state      Direction
+	pending    Direction
+	pendingcnt int
+	lastdir    Direction /// the last direction that was signalled
+	lastactive time.Time /// the last time it was signalled
+}
+
+func NewDebouncer(cfg DebounceConfig) (*Debouncer, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &Debouncer{cfg: cfg}, nil
+}
+
+// / Feed in the next value (e.g. a slope or percentile) at time t, and get the debounced direction
+func (p *Debouncer) Update(value float64, t time.Time) Direction {
+	enter := Neutral
+	if p.cfg.Buy.entered(value) {
+		enter = Buy
+	} else if p.cfg.Sell.entered(value) {
+		enter = Sell
+	}
+	held := false
+	switch p.state {
+	case Buy:
+		held = !p.cfg.Buy.exited(value)
+	case Sell:
+		held = !p.cfg.Sell.exited(value)
+	}
+	return p.step(enter, held, t)
+}
+
+// / Feed in a raw direction at time t - there's no hysteresis, the signal stays on for as long as dir does
+func (p *Debouncer) UpdateDirection(dir Direction, t time.Time) Direction {
+	return p.step(dir, dir != Neutral && dir == p.state, t)
+}
+
+func (p *Debouncer) step(enter Direction, held bool, t time.Time) Direction {
+	if p.state != Neutral {
+		if held {
+			p.lastactive = t
+			p.pending = Neutral
+			p.pendingcnt = 0
+			return p.state
+		}
+		p.state = Neutral
+	}
+	if enter == Neutral {
+		p.pending = Neutral
+		p.pendingcnt = 0
+		return Neutral
+	}
+	if enter == p.pending {
+		p.pendingcnt++
+	} else {
+		p.pending = enter
+		p.pendingcnt = 1
+	}
+	if p.pendingcnt < p.cfg.Confirm {
+		return Neutral
+	}
+	if p.lastdir != Neutral && p.lastdir != enter && t.Sub(p.lastactive) < p.cfg.Cooldown {
+		return Neutral
+	}
+	p.state = enter
+	p.lastdir = enter
+	p.lastactive = t
+	return p.state
+}
+
+// / The current debounced direction
+func (p *Debouncer) Direction() Direction {
+	return p.state
+}
+
+// / Forget all the state - e.g. after a gap in the data
+func (p *Debouncer) Reset() {
+	*p = Debouncer{cfg: p.cfg}
+}
@@ -0,0 +1,80 @@
+package signals
+
+import (
+	"gotest.tools/v3/assert"
+	"testing"
+	"time"
+)
+
+func TestDebouncer_Hysteresis(t *testing.T) {
+	deb, err := NewDebouncer(DebounceConfig{
+		Buy:  Band{Enter: 0.2, Exit: 0.3, Below: true},
+		Sell: Band{Enter: 0.8, Exit: 0.7},
+	})
+	assert.NilError(t, err)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	steps := []struct {
+		val float64
+		exp Direction
+	}{
+		{0.5, Neutral},
+		{0.25, Neutral}, /// not past enter
+		{0.19, Buy},
+		{0.25, Buy}, /// still inside exit
+		{0.3, Buy},
+		{0.31, Neutral},
+		{0.85, Sell},
+		{0.75, Sell},
+		{0.69, Neutral},
+	}
+	for i, step := range steps {
+		assert.Equal(t, deb.Update(step.val, start.Add(time.Duration(i)*time.Second)), step.exp, "step ", i)
+	}
+	assert.Equal(t, deb.Direction(), Neutral)
+
+	/// only a buy band - the unset sell band mustn't signal
+	deb, err = NewDebouncer(DebounceConfig{Buy: Band{Enter: 0.2, Exit: 0.3, Below: true}})
+	assert.NilError(t, err)
+	assert.Equal(t, deb.Update(0.9, start), Neutral)
+	assert.Equal(t, deb.Update(0.1, start.Add(time.Second)), Buy)
+	assert.Equal(t, deb.Update(0.9, start.Add(2*time.Second)), Neutral)
+
+	_, err = NewDebouncer(DebounceConfig{Buy: Band{Enter: 0.2, Exit: 0.1, Below: true}})
+	assert.ErrorContains(t, err, "buy band")
+	_, err = NewDebouncer(DebounceConfig{Confirm: -1})
+	assert.ErrorContains(t, err, "can't be negative")
+}
+
+func TestDebouncer_ConfirmAndCooldown(t *testing.T) {
+	deb, err := NewDebouncer(DebounceConfig{Confirm: 3, Cooldown: time.Minute})
+	assert.NilError(t, err)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(secs int) time.Time {
+		return start.Add(time.Duration(secs) * time.Second)
+	}
+	assert.Equal(t, deb.UpdateDirection(Buy, at(0)), Neutral)
+	assert.Equal(t, deb.UpdateDirection(Buy, at(1)), Neutral)
+	assert.Equal(t, deb.UpdateDirection(Neutral, at(2)), Neutral, "Confirmation must be consecutive")
+	for i := 3; i < 5; i++ {
+		assert.Equal(t, deb.UpdateDirection(Buy, at(i)), Neutral)
+	}
+	assert.Equal(t, deb.UpdateDirection(Buy, at(5)), Buy, "Confirmed after 3 in a row")
+	assert.Equal(t, deb.UpdateDirection(Buy, at(10)), Buy)
+
+	/// opposite signal within the cooldown of the buy last being on
+	for i := 11; i < 70; i++ {
+		assert.Equal(t, deb.UpdateDirection(Sell, at(i)), Neutral, "In cooldown at ", i)
+	}
+	assert.Equal(t, deb.UpdateDirection(Sell, at(70)), Sell, "Cooldown over")
+
+	/// the same direction again isn't held up by the cooldown
+	deb.Reset()
+	for i := 0; i < 3; i++ {
+		deb.UpdateDirection(Buy, at(i))
+	}
+	deb.UpdateDirection(Neutral, at(3))
+	for i := 4; i < 6; i++ {
+		deb.UpdateDirection(Buy, at(i))
+	}
+	assert.Equal(t, deb.UpdateDirection(Buy, at(6)), Buy)
+}
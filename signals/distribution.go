@@ -0,0 +1,144 @@
+package signals
+
+import (
+	"encoding/gob"
+	"fmt"
+	"github.com/paul-at-nangalan/errorhandler/handlers"
+	"io"
+	"math"
+	"time"
+)
+
+type DistributionBackend int
+
+const (
+	BackendBins    DistributionBackend = iota /// the original fixed width bins, aged out by targetage
+	BackendTDigest                            /// a t-digest - bounded memory and accurate tails
+	BackendCustom                             /// the Distribution passed in the config
+)
+
+/*
+*
+Distribution is what a SigPercentile calculates the percentiles from, when it's not using its own bins - either one
+of the built in backends, or any implementation passed in SigPercentileConfig.Distribution.
+Add is given the sample time, so the distribution can age data out by it (e.g. over the target age).
+CDF and Quantile return NaN if there's no data.
+*/
+type Distribution interface {
+	Add(val float64, t time.Time)
+	CDF(val float64) float64
+	Quantile(q float64) float64
+	Count() float64
+	Encode(buffer io.Writer)
+	Decode(buffer io.Reader)
+}
+
+func newDistribution(backend DistributionBackend, compression float64, targetage time.Duration) Distribution {
+	switch backend {
+	case BackendTDigest:
+		return NewRotatingTDigest(compression, targetage)
+	}
+	return nil
+}
+
+func (b DistributionBackend) validate() error {
+	switch b {
+	case BackendBins, BackendTDigest, BackendCustom:
+		return nil
+	}
+	return fmt.Errorf("unknown distribution backend %d", b)
+}
+
+/*
+*
+RotatingTDigest ages data out over targetage by keeping two digests - each covers half the target age. When the
+current one is half the target age old, it becomes the previous one and the old previous one is thrown away, so the
+percentiles are always from between half and all of the target age.
+*/
+type RotatingTDigest struct {
+	compression  float64
+	span         time.Duration
+	current      *TDigest
+	previous     *TDigest
+	currentstart time.Time
+}
+
+func NewRotatingTDigest(compression float64, targetage time.Duration) *RotatingTDigest {
+	return &RotatingTDigest{
+		compression: compression,
+		span:        targetage / 2,
+		current:     NewTDigest(compression),
+		previous:    NewTDigest(compression),
+	}
+}
+
+func (p *RotatingTDigest) Add(val float64, t time.Time) {
+	if p.currentstart.IsZero() {
+		p.currentstart = t
+	}
+	if age := t.Sub(p.currentstart); age >= p.span {
+		p.previous = p.current
+		if age >= 2*p.span { /// nothing recent enough to keep
+			p.previous = NewTDigest(p.compression)
+		}
+		p.current = NewTDigest(p.compression)
+		p.currentstart = t
+	}
+	p.current.Add(val)
+}
+
+func (p *RotatingTDigest) Count() float64 {
+	return p.current.Count() + p.previous.Count()
+}
+
+func (p *RotatingTDigest) CDF(val float64) float64 {
+	if p.Count() == 0 {
+		return math.NaN()
+	}
+	return (p.current.weightBelow(val) + p.previous.weightBelow(val)) / p.Count()
+}
+
+func (p *RotatingTDigest) Quantile(q float64) float64 {
+	if p.previous.Count() == 0 {
+		return p.current.Quantile(q)
+	}
+	if p.current.Count() == 0 {
+		return p.previous.Quantile(q)
+	}
+	all := append(append([]centroid{}, p.current.mergedCentroids()...), p.previous.mergedCentroids()...)
+	return quantileOf(p.current.merge(all, nil),
+		math.Min(p.current.min, p.previous.min), math.Max(p.current.max, p.previous.max), q)
+}
+
+// / Exported fields so it can be gob encoded
+type rotatingTDigestState struct {
+	Compression  float64
+	Span         time.Duration
+	CurrentStart time.Time
+	Current      tdigestState
+	Previous     tdigestState
+}
+
+func (p *RotatingTDigest) Encode(buffer io.Writer) {
+	enc := gob.NewEncoder(buffer)
+	err := enc.Encode(rotatingTDigestState{
+		Compression:  p.compression,
+		Span:         p.span,
+		CurrentStart: p.currentstart,
+		Current:      p.current.state(),
+		Previous:     p.previous.state(),
+	})
+	handlers.PanicOnError(err)
+}
+
+func (p *RotatingTDigest) Decode(buffer io.Reader) {
+	dec := gob.NewDecoder(buffer)
+	state := rotatingTDigestState{}
+	err := dec.Decode(&state)
+	handlers.PanicOnError(err)
+	p.compression = state.Compression
+	p.span = state.Span
+	p.currentstart = state.CurrentStart
+	p.current = tdigestFromState(state.Current)
+	p.previous = tdigestFromState(state.Previous)
+}
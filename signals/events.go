@@ -0,0 +1,67 @@
+package signals
+
+import (
+	"time"
+)
+
+/*
+*
+SignalEvent is sent whenever a signal's direction changes - including back to Neutral.
+Value is the sample that caused the change. Slope is only set by SigCurve (and MultiSigCurve, for its first window) and
+Percentile only by SigPercentile - the other one is NaN.
+*/
+type SignalEvent struct {
+	Direction  Direction
+	Time       time.Time
+	Value      float64
+	Slope      float64
+	Percentile float64
+}
+
+/*
+*
+eventSource keeps track of the last direction and tells the listeners when it changes.
+Callbacks are called on the goroutine adding the data, so they should be quick, and if the signal is wrapped in a
+Sync* wrapper they mustn't call back into it (the wrapper is locked for the whole add).
+Channel sends never block - if a channel's buffer is full, the event is dropped for that channel.
+*/
+type eventSource struct {
+	last      Direction
+	callbacks []func(SignalEvent)
+	chans     []chan SignalEvent
+	dropped   int64
+}
+
+func (p *eventSource) onChange(callback func(SignalEvent)) {
+	p.callbacks = append(p.callbacks, callback)
+}
+
+func (p *eventSource) events(buffer int) <-chan SignalEvent {
+	ch := make(chan SignalEvent, buffer)
+	p.chans = append(p.chans, ch)
+	return ch
+}
+
+func (p *eventSource) closeEvents() {
+	for _, ch := range p.chans {
+		close(ch)
+	}
+	p.chans = nil
+}
+
+func (p *eventSource) update(event SignalEvent) {
+	if event.Direction == p.last {
+		return
+	}
+	p.last = event.Direction
+	for _, callback := range p.callbacks {
+		callback(event)
+	}
+	for _, ch := range p.chans {
+		select {
+		case ch <- event:
+		default:
+			p.dropped++
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package signals
+
+import (
+	"golang.org/x/exp/rand"
+	"gotest.tools/v3/assert"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestEventSource(t *testing.T) {
+	src := eventSource{}
+	var got []Direction
+	src.onChange(func(event SignalEvent) {
+		got = append(got, event.Direction)
+	})
+	ch := src.events(2)
+	for _, dir := range []Direction{Neutral, Buy, Buy, Neutral, Sell, Sell, Buy} {
+		src.update(SignalEvent{Direction: dir})
+	}
+	assert.DeepEqual(t, got, []Direction{Buy, Neutral, Sell, Buy})
+	/// the channel only had room for 2
+	assert.Equal(t, src.dropped, int64(2))
+	assert.Equal(t, (<-ch).Direction, Buy)
+	assert.Equal(t, (<-ch).Direction, Neutral)
+	src.closeEvents()
+	_, ok := <-ch
+	assert.Equal(t, ok, false, "Expected the channel to be closed")
+	src.update(SignalEvent{Direction: Sell}) /// must not send on the closed channel
+}
+
+func TestSigCurve_Events(t *testing.T) {
+	sig := NewSigCurve(400, 50, 0.001, 10, 0.45)
+	var events []SignalEvent
+	sig.OnChange(func(event SignalEvent) {
+		events = append(events, event)
+		assert.Equal(t, DirectionOf(sig), event.Direction, "The signal should already be in the new state")
+	})
+	ch := sig.Events(100)
+	runVShape(sig, 600)
+	sig.CloseEvents()
+
+	assert.Assert(t, len(events) >= 2, "Expected at least a sell then a buy ", len(events))
+	assert.Equal(t, events[0].Direction, Sell)
+	assert.Equal(t, events[len(events)-1].Direction, Buy)
+	for _, event := range events {
+		assert.Assert(t, math.IsNaN(event.Percentile))
+		/// runVShape feeds |i - 200| + 100 at i seconds
+		i := event.Time.Sub(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) / time.Second
+		assert.Equal(t, event.Value, math.Abs(float64(i-200))+100)
+		if event.Direction == Buy {
+			assert.Assert(t, event.Slope > 0)
+		}
+	}
+	count := 0
+	for range ch {
+		count++
+	}
+	assert.Equal(t, count, len(events))
+	assert.Equal(t, sig.DroppedEvents(), int64(0))
+}
+
+func TestSigPercentile_Events(t *testing.T) {
+	sig := NewSigPercentile(0.25, 0.75, 1000, time.Hour)
+	var events []SignalEvent
+	sig.OnChange(func(event SignalEvent) {
+		events = append(events, event)
+	})
+	fillSigAt(rand.NewSource(7), sig, 3000, 100, 200, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Second)
+	assert.Assert(t, len(events) > 10, "Expected the signal to change state on random data ", len(events))
+	for _, event := range events {
+		assert.Assert(t, math.IsNaN(event.Slope))
+		switch event.Direction {
+		case Buy:
+			assert.Assert(t, event.Percentile < 0.25, event.Percentile)
+		case Sell:
+			assert.Assert(t, event.Percentile > 0.75, event.Percentile)
+		default:
+			assert.Assert(t, event.Percentile >= 0.25 && event.Percentile <= 0.75, event.Percentile)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package signals
+
+import (
+	"github.com/paul-at-nangalan/signals/managedslice"
+	"github.com/paul-at-nangalan/signals/signals/storables"
+)
+
+/*
+*
+extremaDeque is a fixed capacity double ended queue of (sequence number, value), used to keep a monotonic queue.
+*/
+type extremaDeque struct {
+	seqs []int64
+	vals []float64
+	head int
+	n    int
+}
+
+func newExtremaDeque(capacity int) extremaDeque {
+	return extremaDeque{
+		seqs: make([]int64, capacity),
+		vals: make([]float64, capacity),
+	}
+}
+
+func (p *extremaDeque) pos(i int) int {
+	return (p.head + i) % len(p.seqs)
+}
+
+func (p *extremaDeque) pushBack(seq int64, val float64) {
+	i := p.pos(p.n)
+	p.seqs[i] = seq
+	p.vals[i] = val
+	p.n++
+}
+
+func (p *extremaDeque) back() float64 {
+	return p.vals[p.pos(p.n-1)]
+}
+
+func (p *extremaDeque) front() (seq int64, val float64) {
+	return p.seqs[p.head], p.vals[p.head]
+}
+
+func (p *extremaDeque) popBack() {
+	p.n--
+}
+
+func (p *extremaDeque) popFront() {
+	p.head = p.pos(1)
+	p.n--
+}
+
+/*
+*
+rollingExtrema tracks the min and max of the last N values pushed, where N can change from push to push
+(it's whatever the caller passes to expire). Each value is pushed and popped at most once from each queue, so it's
+amortised O(1) per value, rather than scanning all the data every time.
+*/
+type rollingExtrema struct {
+	next int64 /// sequence number of the next value
+	live int   /// how many values are in the window
+	mins extremaDeque
+	maxs extremaDeque
+}
+
+// / capacity must be at least one more than the largest window
+func newRollingExtrema(capacity int) rollingExtrema {
+	return rollingExtrema{
+		mins: newExtremaDeque(capacity),
+		maxs: newExtremaDeque(capacity),
+	}
+}
+
+func (p *rollingExtrema) push(val float64) {
+	for p.mins.n > 0 && p.mins.back() >= val {
+		p.mins.popBack()
+	}
+	p.mins.pushBack(p.next, val)
+	for p.maxs.n > 0 && p.maxs.back() <= val {
+		p.maxs.popBack()
+	}
+	p.maxs.pushBack(p.next, val)
+	p.next++
+	p.live++
+}
+
+// / Drop everything but the last window values
+func (p *rollingExtrema) expire(window int) {
+	oldest := p.next - int64(window)
+	for p.mins.n > 0 {
+		if seq, _ := p.mins.front(); seq >= oldest {
+			break
+		}
+		p.mins.popFront()
+	}
+	for p.maxs.n > 0 {
+		if seq, _ := p.maxs.front(); seq >= oldest {
+			break
+		}
+		p.maxs.popFront()
+	}
+	if p.live > window {
+		p.live = window
+	}
+}
+
+func (p *rollingExtrema) min() float64 {
+	_, val := p.mins.front()
+	return val
+}
+
+func (p *rollingExtrema) max() float64 {
+	_, val := p.maxs.front()
+	return val
+}
+
+// / Call before pushing a new value onto data - rebuilds from data if out of step (e.g. just loaded from storage)
+func (p *rollingExtrema) sync(data *managedslice.Slice[storables.StorableFloat], capacity int) {
+	if len(p.mins.seqs) != 0 && p.live == data.Len() {
+		return
+	}
+	*p = newRollingExtrema(capacity)
+	for _, val := range data.Items() {
+		p.push(float64(val))
+	}
+}
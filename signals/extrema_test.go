@@ -0,0 +1,96 @@
+package signals
+
+import (
+	"golang.org/x/exp/rand"
+	"gotest.tools/v3/assert"
+	"math"
+	"testing"
+	"time"
+)
+
+// / What getPriceRangeOverAllData used to do on every sample
+func scanPriceRange(sig *SigCurve) (minprice, maxprice float64) {
+	min := sig.samples.variance.At(0)
+	max := sig.samples.variance.At(0)
+	for _, val := range sig.samples.variance.Items() {
+		if val < min {
+			min = val
+		}
+		if val > max {
+			max = val
+		}
+	}
+	return float64(min), float64(max)
+}
+
+func TestRollingExtrema(t *testing.T) {
+	rnd := rand.New(rand.NewSource(7))
+	ext := newRollingExtrema(51)
+	vals := make([]float64, 0)
+	window := 1
+	for i := 0; i < 5000; i++ {
+		val := float64(rnd.Intn(100)) /// plenty of repeats
+		vals = append(vals, val)
+		ext.push(val)
+		/// the window grows and shrinks
+		if rnd.Intn(3) == 0 && window > 1 {
+			window--
+		} else if window < 50 {
+			window++
+		}
+		if window > len(vals) {
+			window = len(vals)
+		}
+		ext.expire(window)
+		expmin := math.Inf(1)
+		expmax := math.Inf(-1)
+		for _, v := range vals[len(vals)-window:] {
+			expmin = math.Min(expmin, v)
+			expmax = math.Max(expmax, v)
+		}
+		assert.Equal(t, ext.min(), expmin, "Mismatch min at ", i)
+		assert.Equal(t, ext.max(), expmax, "Mismatch max at ", i)
+	}
+}
+
+func TestSigCurve_PriceRange(t *testing.T) {
+	rnd := rand.New(rand.NewSource(11))
+	sig := NewSigCurve(300, 200, 0.35, 10, 0.45)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3000; i++ {
+		sig.AddVarianceSample(100+rnd.NormFloat64()*10+float64(i%500)/10, start.Add(time.Duration(i)*time.Second))
+		minprice, maxprice := sig.getPriceRangeOverAllData()
+		expmin, expmax := scanPriceRange(sig)
+		assert.Equal(t, minprice, expmin, "Mismatch min at ", i)
+		assert.Equal(t, maxprice, expmax, "Mismatch max at ", i)
+		if i == 1500 {
+			/// as if just loaded from storage
+			sig.samples.extrema = rollingExtrema{}
+		}
+	}
+}
+
+func BenchmarkSigCurve_ScanPriceRange100k(b *testing.B) {
+	sig := NewSigCurve(100000, 50000, 0.35, 100, 0.45)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 100000; i++ {
+		sig.AddVarianceSample(math.Sin(float64(i)/1000), start.Add(time.Duration(i)*time.Second))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		scanPriceRange(sig)
+	}
+}
+
+func BenchmarkSigCurve_AddVarianceSample100k(b *testing.B) {
+	sig := NewSigCurve(100000, 50000, 0.35, 100, 0.45)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 100000; i++ {
+		sig.AddVarianceSample(math.Sin(float64(i)/1000), start.Add(time.Duration(i)*time.Second))
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sig.AddVarianceSample(math.Sin(float64(i)/1000), start.Add(time.Duration(100000+i)*time.Second))
+	}
+}
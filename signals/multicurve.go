@@ -0,0 +1,418 @@
+package signals
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"github.com/paul-at-nangalan/errorhandler/handlers"
+	"github.com/paul-at-nangalan/short-term-store/store"
+	perfstats "github.com/paul-at-nangalan/stats/stats"
+	"io"
+	"math"
+	"time"
+)
+
+/*
+*
+MultiSigCurveConfig is the same as SigCurveConfig, but with a list of windows rather than one - each window is a
+timeframe with its own slope. NumSamples and MinDataPoints are shared, so every window must fit in them as it would
+for a single SigCurve.
+The Debounce is applied to the aligned direction (see Aligned), so it can't have bands - there's no single slope.
+*/
+type MultiSigCurveConfig struct {
+	Windows       []int
+	NumSamples    int
+	MinDataPoints int
+	MinSlope      float64
+	MinRSqrd      float64
+	ShiftFactor   float64
+	Clock         Clock /// only used to decide when to save - defaults to WallClock
+	BadSamples    BadSamplePolicy
+	Debounce      *DebounceConfig
+}
+
+func (c MultiSigCurveConfig) Validate() error {
+	if len(c.Windows) == 0 {
+		return fmt.Errorf("need at least one window")
+	}
+	seen := make(map[int]bool)
+	for _, window := range c.Windows {
+		if seen[window] {
+			return fmt.Errorf("window %d is listed more than once", window)
+		}
+		seen[window] = true
+		if err := c.curveConfig(window).Validate(); err != nil {
+			return fmt.Errorf("window %d: %w", window, err)
+		}
+	}
+	if c.BadSamples < BadSampleDrop || c.BadSamples > BadSampleError {
+		return fmt.Errorf("unknown bad sample policy %d", c.BadSamples)
+	}
+	if c.Debounce != nil {
+		if err := c.Debounce.Validate(); err != nil {
+			return err
+		}
+		if c.Debounce.hasBands() {
+			return fmt.Errorf("debounce bands can't be used with a MultiSigCurve - there's no single slope to apply them to")
+		}
+	}
+	return nil
+}
+
+// / The config for the SigCurve for one window - the bad samples and debounce are handled by the MultiSigCurve
+func (c MultiSigCurveConfig) curveConfig(window int) SigCurveConfig {
+	return SigCurveConfig{
+		NumSamples:    c.NumSamples,
+		MinDataPoints: c.MinDataPoints,
+		MinSlope:      c.MinSlope,
+		Window:        window,
+		MinRSqrd:      c.MinRSqrd,
+	}
+}
+
+// / Options added after the original set of parameters - see curveOptions
+type multiCurveOptions struct {
+	BadSamples BadSamplePolicy
+	Debounce   *DebounceConfig
+}
+
+/*
+*
+MultiSigCurve is several SigCurves with different windows over the same samples, so the samples (and their min and max)
+are only kept once. Each window has its own rolling regression and curve of slopes, giving a trend per timeframe, and
+it signals buy or sell only when all the timeframes agree.
+*/
+type MultiSigCurve struct {
+	samples *sampleBuffer
+	curves  []*SigCurve /// one per window, all on samples - only the MultiSigCurve pushes onto it
+
+	numsamples    int
+	mindatapoints int
+	minslope      float64
+	minrsqrd      float64
+	shiftfactor   float64
+	opts          multiCurveOptions
+
+	sigbuy   bool
+	sigsell  bool
+	rejected int64
+	debounce *Debouncer
+	events   eventSource
+
+	statsbuysig   *perfstats.Counter
+	statssellsig  *perfstats.Counter
+	statsrejected *perfstats.Counter
+
+	clock        Clock
+	datastore    store.Store
+	storagename  string
+	saveduration time.Duration
+	lastsaved    time.Time
+}
+
+func NewMultiSigCurve(cfg MultiSigCurveConfig) (*MultiSigCurve, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	shiftfactor := cfg.ShiftFactor
+	if shiftfactor == 0 {
+		shiftfactor = 1
+	}
+	p := &MultiSigCurve{
+		samples:       newSampleBuffer(cfg.NumSamples),
+		numsamples:    cfg.NumSamples,
+		mindatapoints: cfg.MinDataPoints,
+		minslope:      cfg.MinSlope,
+		minrsqrd:      cfg.MinRSqrd,
+		shiftfactor:   shiftfactor,
+		clock:         cfg.Clock,
+		opts: multiCurveOptions{
+			BadSamples: cfg.BadSamples,
+			Debounce:   cfg.Debounce,
+		},
+	}
+	p.setupCurves(cfg.Windows)
+	p.setupStats("")
+	p.setupDebounce()
+	return p, nil
+}
+
+// / The window curves' stats are included, prefixed with the window
+func (p *MultiSigCurve) setupStats(prefix string) {
+	p.statsbuysig = perfstats.NewCounter(prefix + "multi-curve-buy-signalled")
+	p.statssellsig = perfstats.NewCounter(prefix + "multi-curve-sell-signalled")
+	p.statsrejected = perfstats.NewCounter(prefix + "multi-curve-sample-rejected")
+	for _, curve := range p.curves {
+		curve.setupStats(fmt.Sprintf("%swindow-%d-", prefix, curve.window))
+	}
+}
+
+// / Put prefix in front of all the stats counter names, e.g. to tell two MultiSigCurves apart. The counts start again
+func (p *MultiSigCurve) SetStatsPrefix(prefix string) {
+	p.setupStats(prefix)
+}
+
+func (p *MultiSigCurve) setupCurves(windows []int) {
+	cfg := MultiSigCurveConfig{
+		NumSamples:    p.numsamples,
+		MinDataPoints: p.mindatapoints,
+		MinSlope:      p.minslope,
+		MinRSqrd:      p.minrsqrd,
+	}
+	p.curves = make([]*SigCurve, len(windows))
+	for i, window := range windows {
+		p.curves[i] = newSigCurve(cfg.curveConfig(window), p.samples)
+	}
+}
+
+// / As for SigCurve, the debouncer's state isn't stored
+func (p *MultiSigCurve) setupDebounce() {
+	p.debounce = nil
+	if p.opts.Debounce != nil {
+		p.debounce = &Debouncer{cfg: *p.opts.Debounce}
+	}
+}
+
+func (p *MultiSigCurve) Encode(buffer io.Writer) {
+	params := &bytes.Buffer{}
+	enc := gob.NewEncoder(params)
+	err := enc.Encode(p.Windows())
+	handlers.PanicOnError(err)
+	err = enc.Encode(p.numsamples)
+	handlers.PanicOnError(err)
+	err = enc.Encode(p.mindatapoints)
+	handlers.PanicOnError(err)
+	err = enc.Encode(p.minslope)
+	handlers.PanicOnError(err)
+	err = enc.Encode(p.minrsqrd)
+	handlers.PanicOnError(err)
+	err = enc.Encode(p.shiftfactor)
+	handlers.PanicOnError(err)
+	err = enc.Encode(p.saveduration)
+	handlers.PanicOnError(err)
+	err = enc.Encode(p.opts)
+	handlers.PanicOnError(err)
+
+	buffer.Write(params.Bytes())
+}
+
+func (p *MultiSigCurve) Decode(buffer io.Reader) {
+	dec := gob.NewDecoder(buffer)
+	windows := []int{}
+	err := dec.Decode(&windows)
+	handlers.PanicOnError(err)
+	err = dec.Decode(&p.numsamples)
+	handlers.PanicOnError(err)
+	err = dec.Decode(&p.mindatapoints)
+	handlers.PanicOnError(err)
+	err = dec.Decode(&p.minslope)
+	handlers.PanicOnError(err)
+	err = dec.Decode(&p.minrsqrd)
+	handlers.PanicOnError(err)
+	err = dec.Decode(&p.shiftfactor)
+	handlers.PanicOnError(err)
+	err = dec.Decode(&p.saveduration)
+	handlers.PanicOnError(err)
+	err = dec.Decode(&p.opts)
+	handlers.PanicOnError(err)
+	p.setupCurves(windows)
+	p.setupDebounce()
+}
+
+func (p *MultiSigCurve) curvename(curve *SigCurve) string {
+	return fmt.Sprintf("%s-curve-%d", p.storagename, curve.window)
+}
+
+func (p *MultiSigCurve) storeData() {
+	now := p.now()
+	if p.datastore == nil || p.lastsaved.Add(p.saveduration).After(now) {
+		return
+	}
+	p.lastsaved = now
+	p.samples.store(p.datastore, p.storagename)
+	for _, curve := range p.curves {
+		curve.storeCurve(p.datastore, p.curvename(curve))
+	}
+	p.datastore.Store(p.storagename, p)
+}
+
+func (p *MultiSigCurve) retrieveData(maxage time.Duration) (isvalid bool) {
+	/// the parameters first - they say which curves there are
+	isvalid = p.datastore.Retrieve(p.storagename, maxage, p)
+	if !isvalid {
+		return false
+	}
+	if !p.samples.retrieve(p.datastore, p.storagename, maxage) {
+		return false
+	}
+	for _, curve := range p.curves {
+		if !curve.retrieveCurve(p.datastore, p.curvename(curve), maxage) {
+			return false
+		}
+	}
+	return true
+}
+
+// // This just sets up the storage - it won't save it
+func (p *MultiSigCurve) SetupStorage(storename string, fs store.Store, howoftentosave time.Duration) {
+	p.storagename = storename
+	p.datastore = fs
+	p.saveduration = howoftentosave
+}
+
+// / See LoadFromStorage - the rolling regressions and min/max are rebuilt from the samples on the next AddVarianceSample
+func LoadMultiSigCurveFromStorage(storename string, fs store.Store, maxage time.Duration) (sig *MultiSigCurve, isvalid bool) {
+	sig = &MultiSigCurve{
+		samples:     &sampleBuffer{},
+		storagename: storename,
+		datastore:   fs,
+	}
+	isvalid = sig.retrieveData(maxage)
+	if !isvalid {
+		return nil, false
+	}
+	sig.setupStats("") /// after loading - the window curves' stats come from the parameters
+	return sig, true
+}
+
+// / Set the clock used to throttle saves - e.g. a ManualClock when replaying historical data
+func (p *MultiSigCurve) SetClock(clock Clock) {
+	p.clock = clock
+}
+
+func (p *MultiSigCurve) now() time.Time {
+	if p.clock == nil {
+		return time.Now()
+	}
+	return p.clock.Now()
+}
+
+/*
+*
+NaN/Inf samples are handled according to the BadSamplePolicy - an error is only returned for BadSampleError
+*/
+func (p *MultiSigCurve) AddVarianceSample(variance float64, t time.Time) error {
+	p.storeData()
+	sample, bad, keep, err := p.samples.check(variance, variance*p.shiftfactor, t, p.opts.BadSamples)
+	if bad {
+		p.rejected++
+		p.statsrejected.Inc()
+	}
+	if !keep {
+		return err
+	}
+	p.samples.push(sample, t, p.numsamples, 0)
+	for _, curve := range p.curves {
+		curve.update(sample, t)
+	}
+
+	dir := p.Aligned()
+	if p.debounce != nil {
+		dir = p.debounce.UpdateDirection(dir, t)
+	}
+	switch dir {
+	case Buy:
+		p.statsbuysig.Inc()
+	case Sell:
+		p.statssellsig.Inc()
+	}
+	p.sigbuy = dir == Buy
+	p.sigsell = dir == Sell
+	p.events.update(SignalEvent{
+		Direction:  dir,
+		Time:       t,
+		Value:      sample,
+		Slope:      p.curves[0].lastSlope(),
+		Percentile: math.NaN(),
+	})
+	return nil
+}
+
+// / The windows, in the order they were configured - Trends and Slopes are in the same order
+func (p *MultiSigCurve) Windows() []int {
+	windows := make([]int, len(p.curves))
+	for i, curve := range p.curves {
+		windows[i] = curve.window
+	}
+	return windows
+}
+
+// / The trend for each window - Neutral until the window has enough slopes
+func (p *MultiSigCurve) Trends() []Direction {
+	trends := make([]Direction, len(p.curves))
+	for i, curve := range p.curves {
+		trends[i] = DirectionOf(curve)
+	}
+	return trends
+}
+
+// / The latest slope for each window - NaN if there isn't one yet
+func (p *MultiSigCurve) Slopes() []float64 {
+	slopes := make([]float64, len(p.curves))
+	for i, curve := range p.curves {
+		slopes[i] = curve.lastSlope()
+	}
+	return slopes
+}
+
+// / Buy or Sell if every window has that trend, otherwise Neutral. This is before the debounce, if there is one
+func (p *MultiSigCurve) Aligned() Direction {
+	aligned := Neutral
+	for i, dir := range p.Trends() {
+		if dir == Neutral || (i > 0 && dir != aligned) {
+			return Neutral
+		}
+		aligned = dir
+	}
+	return aligned
+}
+
+func (p *MultiSigCurve) SigBuy() bool {
+	return p.sigbuy
+}
+
+func (p *MultiSigCurve) SigSell() bool {
+	return p.sigsell
+}
+
+// / How many NaN/Inf samples have been passed to AddVarianceSample, whatever the policy did with them
+func (p *MultiSigCurve) RejectedSamples() int64 {
+	return p.rejected
+}
+
+// / Register a callback for whenever the direction changes - see eventSource for the caveats
+func (p *MultiSigCurve) OnChange(callback func(SignalEvent)) {
+	p.events.onChange(callback)
+}
+
+// / A channel of direction changes. Sends don't block - if the buffer fills up, events are dropped
+func (p *MultiSigCurve) Events(buffer int) <-chan SignalEvent {
+	return p.events.events(buffer)
+}
+
+// / Close all the channels returned by Events
+func (p *MultiSigCurve) CloseEvents() {
+	p.events.closeEvents()
+}
+
+// / How many events have been dropped because a channel was full
+func (p *MultiSigCurve) DroppedEvents() int64 {
+	return p.events.dropped
+}
+
+func (p *MultiSigCurve) GetStatsCounters() []perfstats.Stat {
+	stats := []perfstats.Stat{p.statsbuysig, p.statssellsig, p.statsrejected}
+	for _, curve := range p.curves {
+		stats = append(stats, curve.GetStatsCounters()...)
+	}
+	return stats
+}
+
+func (p *MultiSigCurve) Plot() {
+	p.samples.plot()
+	for _, curve := range p.curves {
+		fmt.Println()
+		fmt.Println("Window ", curve.window)
+		curve.plotCurve()
+	}
+}
@@ -0,0 +1,150 @@
+package signals
+
+import (
+	"gotest.tools/v3/assert"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestMultiSigCurve_MatchesSigCurve(t *testing.T) {
+	windows := []int{10, 30, 60}
+	multi, err := NewMultiSigCurve(MultiSigCurveConfig{Windows: windows, NumSamples: 400, MinDataPoints: 100,
+		MinSlope: 0.001, MinRSqrd: 0.3})
+	assert.NilError(t, err)
+	singles := make([]*SigCurve, len(windows))
+	for i, window := range windows {
+		singles[i] = NewSigCurve(400, 100, 0.001, window, 0.3)
+	}
+
+	rnd := rand.New(rand.NewSource(11))
+	sampletime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	val := 100.0
+	for i := 0; i < 3000; i++ {
+		sampletime = sampletime.Add(time.Duration(1+rnd.Intn(3000)) * time.Millisecond)
+		val += rnd.NormFloat64() + 0.2*math.Sin(float64(i)/100)
+		assert.NilError(t, multi.AddVarianceSample(val, sampletime))
+		for _, single := range singles {
+			single.AddVarianceSample(val, sampletime)
+		}
+		slopes := multi.Slopes()
+		trends := multi.Trends()
+		for j, single := range singles {
+			assert.Equal(t, multi.curves[j].variancecurve.Len(), single.variancecurve.Len(), "curve len, window ", windows[j], " at ", i)
+			if single.variancecurve.Len() > 0 {
+				assertClose(t, slopes[j], float64(single.variancecurve.FromBack(0)), "slope, window ", windows[j], " at ", i)
+			}
+			assert.Equal(t, trends[j], DirectionOf(single), "trend, window ", windows[j], " at ", i)
+		}
+	}
+	assert.DeepEqual(t, multi.Windows(), windows)
+}
+
+func TestMultiSigCurve_Aligned(t *testing.T) {
+	multi, err := NewMultiSigCurve(MultiSigCurveConfig{Windows: []int{10, 60}, NumSamples: 400, MinDataPoints: 100,
+		MinSlope: 0.001, MinRSqrd: 0.45})
+	assert.NilError(t, err)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	disagreed := false
+	for i := 0; i < 600; i++ {
+		multi.AddVarianceSample(math.Abs(float64(i-200))+100, start.Add(time.Duration(i)*time.Second))
+		trends := multi.Trends()
+		if trends[0] == Buy && trends[1] == Sell {
+			/// just after the bottom - the short window has turned but the long one hasn't
+			disagreed = true
+			assert.Equal(t, multi.Aligned(), Neutral)
+			assert.Equal(t, DirectionOf(multi), Neutral)
+		}
+		if i == 190 {
+			assert.Equal(t, DirectionOf(multi), Sell, "Both should be down before the bottom")
+		}
+	}
+	assert.Equal(t, disagreed, true, "Expected the timeframes to disagree after the turn")
+	assert.Equal(t, DirectionOf(multi), Buy)
+	assert.DeepEqual(t, multi.Trends(), []Direction{Buy, Buy})
+
+	assert.NilError(t, multi.AddVarianceSample(math.NaN(), start.Add(time.Hour)))
+	assert.Equal(t, multi.RejectedSamples(), int64(1))
+}
+
+func TestMultiSigCurve_Options(t *testing.T) {
+	cfg := MultiSigCurveConfig{Windows: []int{10, 60}, NumSamples: 400, MinDataPoints: 100, MinSlope: 0.001,
+		MinRSqrd: 0.45, BadSamples: BadSampleError, Debounce: &DebounceConfig{Confirm: 5}}
+	multi, err := NewMultiSigCurve(cfg)
+	assert.NilError(t, err)
+	events := []SignalEvent{}
+	multi.OnChange(func(event SignalEvent) {
+		events = append(events, event)
+	})
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	firstaligned := -1
+	for i := 0; i < 300; i++ {
+		multi.AddVarianceSample(float64(i), start.Add(time.Duration(i)*time.Second))
+		if firstaligned < 0 && multi.Aligned() == Buy {
+			firstaligned = i
+		}
+	}
+	assert.Assert(t, firstaligned > 0, "Expected both windows to go up")
+	assert.Equal(t, len(events), 1)
+	assert.Equal(t, events[0].Direction, Buy)
+	assert.Equal(t, events[0].Time, start.Add(time.Duration(firstaligned+4)*time.Second), "Expected the debounce to confirm it")
+	assert.Assert(t, events[0].Slope > cfg.MinSlope, "Expected the slope of the first window ", events[0].Slope)
+
+	err = multi.AddVarianceSample(math.Inf(1), start.Add(time.Hour))
+	assert.ErrorIs(t, err, ErrBadSample)
+	assert.Equal(t, multi.RejectedSamples(), int64(1))
+	assert.Equal(t, multi.samples.Len(), 300)
+
+	cfg.Debounce = &DebounceConfig{Buy: Band{Enter: 1, Exit: 0.5}}
+	_, err = NewMultiSigCurve(cfg)
+	assert.ErrorContains(t, err, "bands")
+}
+
+func TestMultiSigCurve_StoreAndRetrieve(t *testing.T) {
+	cfg := MultiSigCurveConfig{Windows: []int{10, 60}, NumSamples: 400, MinDataPoints: 100, MinSlope: 0.001,
+		MinRSqrd: 0.45}
+	multi, err := NewMultiSigCurve(cfg)
+	assert.NilError(t, err)
+	clock := NewManualClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	multi.SetClock(clock)
+	fs := newMemStore()
+	multi.SetupStorage("multi-curve", fs, time.Hour)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 500; i++ {
+		multi.AddVarianceSample(float64(i), start.Add(time.Duration(i)*time.Second))
+	}
+	/// the next sample saves
+	clock.Advance(2 * time.Hour)
+	multi.AddVarianceSample(500, start.Add(500*time.Second))
+
+	loaded, isvalid := LoadMultiSigCurveFromStorage("multi-curve", fs, 24*time.Hour)
+	assert.Equal(t, isvalid, true)
+	assert.DeepEqual(t, loaded.Windows(), cfg.Windows)
+	assert.Equal(t, loaded.samples.variance.Len(), 400)
+	assert.Equal(t, float64(loaded.samples.variance.FromBack(0)), 499.0)
+
+	/// it saved before adding 500
+	loaded.AddVarianceSample(500, start.Add(500*time.Second))
+	loaded.AddVarianceSample(501, start.Add(501*time.Second))
+	multi.AddVarianceSample(501, start.Add(501*time.Second))
+	for i, slope := range loaded.Slopes() {
+		assertClose(t, slope, multi.Slopes()[i], "slope after reload, frame ", i)
+	}
+	assert.Equal(t, DirectionOf(loaded), Buy)
+
+	_, isvalid = LoadMultiSigCurveFromStorage("nothing-stored", fs, time.Hour)
+	assert.Equal(t, isvalid, false)
+}
+
+func TestMultiSigCurveConfig_Validate(t *testing.T) {
+	cfg := MultiSigCurveConfig{NumSamples: 400, MinDataPoints: 100, MinSlope: 0.001, MinRSqrd: 0.45}
+	_, err := NewMultiSigCurve(cfg)
+	assert.ErrorContains(t, err, "at least one window")
+	cfg.Windows = []int{10, 10}
+	_, err = NewMultiSigCurve(cfg)
+	assert.ErrorContains(t, err, "more than once")
+	cfg.Windows = []int{10, 300}
+	_, err = NewMultiSigCurve(cfg)
+	assert.ErrorContains(t, err, "window 300")
+}
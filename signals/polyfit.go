@@ -0,0 +1,109 @@
+package signals
+
+import (
+	"gonum.org/v1/gonum/mat"
+	"math"
+)
+
+/*
+*
+PolyFit is a least squares polynomial fit over a window of samples, using the same x and y as the linear
+regression - x is time in units of the average time between samples from the start of the window, y is the
+sample normalised over the range of all the data.
+*/
+type PolyFit struct {
+	Coefficients []float64 /// lowest order first, y = c0 + c1 x + c2 x^2 ...
+	RSquared     float64
+	Slope        float64 /// first derivative at the end of the window
+	Curvature    float64 /// second derivative at the end of the window
+
+	/// How significant the slope is - only for straight line fits, NaN for higher degrees. PValue is two sided
+	SlopeStdErr float64
+	TStat       float64
+	PValue      float64
+}
+
+func (p PolyFit) copy() PolyFit {
+	coeffs := make([]float64, len(p.Coefficients))
+	copy(coeffs, p.Coefficients)
+	p.Coefficients = coeffs
+	return p
+}
+
+// / If the fit can't be done (too few points, or all at the same x) everything is NaN
+func fitPolynomial(x, y []float64, degree int) PolyFit {
+	fit := PolyFit{
+		Coefficients: make([]float64, degree+1),
+		RSquared:     math.NaN(),
+		Slope:        math.NaN(),
+		Curvature:    math.NaN(),
+		SlopeStdErr:  math.NaN(),
+		TStat:        math.NaN(),
+		PValue:       math.NaN(),
+	}
+	for i := range fit.Coefficients {
+		fit.Coefficients[i] = math.NaN()
+	}
+	if len(x) <= degree {
+		return fit
+	}
+	vandermonde := mat.NewDense(len(x), degree+1, nil)
+	for i, xi := range x {
+		pow := float64(1)
+		for j := 0; j <= degree; j++ {
+			vandermonde.Set(i, j, pow)
+			pow *= xi
+		}
+	}
+	var qr mat.QR
+	qr.Factorize(vandermonde)
+	coeffs := mat.NewVecDense(degree+1, fit.Coefficients)
+	if err := qr.SolveVecTo(coeffs, false, mat.NewVecDense(len(y), y)); err != nil {
+		/// singular - e.g. all the samples at the same time
+		for i := range fit.Coefficients {
+			fit.Coefficients[i] = math.NaN()
+		}
+		return fit
+	}
+
+	meany := float64(0)
+	for _, yi := range y {
+		meany += yi
+	}
+	meany /= float64(len(y))
+	ssres := float64(0)
+	sstot := float64(0)
+	for i, xi := range x {
+		diff := y[i] - evalPolynomial(fit.Coefficients, xi)
+		ssres += diff * diff
+		sstot += (y[i] - meany) * (y[i] - meany)
+	}
+	if sstot > 0 { /// otherwise flat data - NaN as for the linear regression
+		fit.RSquared = 1 - ssres/sstot
+	}
+
+	/// derivatives at the end of the window
+	end := x[len(x)-1]
+	fit.Slope = 0
+	fit.Curvature = 0
+	pow := float64(1)
+	for j := 1; j <= degree; j++ {
+		fit.Slope += float64(j) * fit.Coefficients[j] * pow
+		pow *= end
+	}
+	pow = 1
+	for j := 2; j <= degree; j++ {
+		fit.Curvature += float64(j*(j-1)) * fit.Coefficients[j] * pow
+		pow *= end
+	}
+	return fit
+}
+
+func evalPolynomial(coeffs []float64, x float64) float64 {
+	/// Horner's method
+	y := float64(0)
+	for j := len(coeffs) - 1; j >= 0; j-- {
+		y = y*x + coeffs[j]
+	}
+	return y
+}
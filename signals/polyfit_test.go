@@ -0,0 +1,48 @@
+package signals
+
+import (
+	"gotest.tools/v3/assert"
+	"math"
+	"testing"
+)
+
+func TestFitPolynomial(t *testing.T) {
+	x := make([]float64, 20)
+	y := make([]float64, 20)
+	for i := range x {
+		x[i] = float64(i)
+		y[i] = 2 - 0.5*x[i] + 0.25*x[i]*x[i]
+	}
+	fit := fitPolynomial(x, y, 2)
+	assertClose(t, fit.Coefficients[0], 2, "c0")
+	assertClose(t, fit.Coefficients[1], -0.5, "c1")
+	assertClose(t, fit.Coefficients[2], 0.25, "c2")
+	assertClose(t, fit.RSquared, 1, "rsqrd")
+	assertClose(t, fit.Slope, -0.5+0.5*19, "slope at the end")
+	assertClose(t, fit.Curvature, 0.5, "curvature")
+
+	/// a cubic term the fit can't follow
+	for i := range x {
+		y[i] += 0.01 * x[i] * x[i] * x[i]
+	}
+	fit = fitPolynomial(x, y, 2)
+	if !(fit.RSquared < 1 && fit.RSquared > 0.9) {
+		t.Error("Expected a good but not perfect fit ", fit.RSquared)
+	}
+	fit = fitPolynomial(x, y, 3)
+	assertClose(t, fit.Coefficients[3], 0.01, "c3")
+	assertClose(t, evalPolynomial(fit.Coefficients, 10), y[10], "eval")
+}
+
+func TestFitPolynomial_Degenerate(t *testing.T) {
+	fit := fitPolynomial([]float64{0, 1}, []float64{1, 2}, 2)
+	assert.Equal(t, len(fit.Coefficients), 3)
+	assert.Assert(t, math.IsNaN(fit.Slope), "Too few points to fit")
+
+	fit = fitPolynomial([]float64{1, 1, 1, 1}, []float64{1, 2, 3, 4}, 2)
+	assert.Assert(t, math.IsNaN(fit.RSquared), "All at the same x")
+
+	fit = fitPolynomial([]float64{0, 1, 2, 3}, []float64{5, 5, 5, 5}, 2)
+	assert.Assert(t, math.IsNaN(fit.RSquared), "Flat data has no R squared")
+	assertClose(t, fit.Coefficients[0], 5, "flat c0")
+}
@@ -0,0 +1,71 @@
+package signals
+
+import (
+	"github.com/paul-at-nangalan/signals/managedslice"
+	"github.com/paul-at-nangalan/signals/signals/storables"
+	"math"
+	"sort"
+)
+
+/*
+*
+rollingQuantile keeps the last n values both in the order they arrived (so the oldest can be dropped) and sorted
+(so any quantile is a lookup). A push is O(n) for the copy into the sorted slice, but with no allocation.
+*/
+type rollingQuantile struct {
+	n      int
+	recent *managedslice.Slice[storables.StorableFloat]
+	sorted []float64
+}
+
+func newRollingQuantile(n int) rollingQuantile {
+	return rollingQuantile{
+		n:      n,
+		recent: managedslice.NewRingSlice[storables.StorableFloat](0, n),
+		sorted: make([]float64, 0, n),
+	}
+}
+
+// / Use values loaded from storage - the most recent n of them
+func (p *rollingQuantile) restore(recent *managedslice.Slice[storables.StorableFloat]) {
+	p.recent = managedslice.NewRingSlice[storables.StorableFloat](0, p.n)
+	for _, val := range recent.Items() {
+		p.recent.PushAndResize(val)
+	}
+	p.sorted = p.sorted[:0]
+	for _, val := range p.recent.Items() {
+		p.sorted = append(p.sorted, float64(val))
+	}
+	sort.Float64s(p.sorted)
+}
+
+func (p *rollingQuantile) push(val float64) {
+	if p.recent.Len() == p.n {
+		dropped := float64(p.recent.FromBack(p.recent.Len() - 1))
+		i := sort.SearchFloat64s(p.sorted, dropped)
+		p.sorted = append(p.sorted[:i], p.sorted[i+1:]...)
+	}
+	p.recent.PushAndResize(storables.StorableFloat(val))
+	i := sort.SearchFloat64s(p.sorted, val)
+	p.sorted = append(p.sorted, 0)
+	copy(p.sorted[i+1:], p.sorted[i:])
+	p.sorted[i] = val
+}
+
+func (p *rollingQuantile) full() bool {
+	return len(p.sorted) == p.n
+}
+
+// / The q quantile (0 <= q <= 1), interpolating between the values either side. NaN if there's nothing yet
+func (p *rollingQuantile) quantile(q float64) float64 {
+	if len(p.sorted) == 0 {
+		return math.NaN()
+	}
+	pos := q * float64(len(p.sorted)-1)
+	lower := int(math.Floor(pos))
+	if lower >= len(p.sorted)-1 {
+		return p.sorted[len(p.sorted)-1]
+	}
+	frac := pos - float64(lower)
+	return p.sorted[lower] + frac*(p.sorted[lower+1]-p.sorted[lower])
+}
@@ -0,0 +1,48 @@
+package signals
+
+import (
+	"golang.org/x/exp/rand"
+	"gotest.tools/v3/assert"
+	"math"
+	"sort"
+	"testing"
+)
+
+func TestRollingQuantile(t *testing.T) {
+	rnd := rand.New(rand.NewSource(21))
+	q := newRollingQuantile(50)
+	assert.Assert(t, math.IsNaN(q.quantile(0.5)))
+	var all []float64
+	for i := 0; i < 1000; i++ {
+		val := rnd.NormFloat64()
+		if i%10 == 0 {
+			val = 1 /// plenty of duplicates
+		}
+		q.push(val)
+		all = append(all, val)
+		start := len(all) - 50
+		if start < 0 {
+			start = 0
+		}
+		exp := append([]float64{}, all[start:]...)
+		sort.Float64s(exp)
+		assert.DeepEqual(t, q.sorted, exp)
+		assert.Equal(t, q.full(), len(all) >= 50)
+		for _, quant := range []float64{0, 0.1, 0.5, 0.9, 1} {
+			/// linear interpolation between the closest ranks
+			pos := quant * float64(len(exp)-1)
+			lower := math.Floor(pos)
+			expq := exp[int(lower)]
+			if int(lower) < len(exp)-1 {
+				expq += (pos - lower) * (exp[int(lower)+1] - exp[int(lower)])
+			}
+			assertClose(t, q.quantile(quant), expq, "quantile ", quant, " at ", i)
+		}
+	}
+
+	restored := newRollingQuantile(20)
+	restored.restore(q.recent)
+	exp := append([]float64{}, all[len(all)-20:]...)
+	sort.Float64s(exp)
+	assert.DeepEqual(t, restored.sorted, exp)
+}
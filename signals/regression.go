@@ -0,0 +1,190 @@
+package signals
+
+import (
+	"github.com/paul-at-nangalan/signals/managedslice"
+	"github.com/paul-at-nangalan/signals/signals/storables"
+	"gonum.org/v1/gonum/stat/distuv"
+	"math"
+	"time"
+)
+
+const (
+	/// how close to zero (relative to the raw sums) the spread of x or y must be to count as no spread at all
+	REGRESSION_TOLERANCE = 1e-12
+)
+
+/*
+*
+rollingRegression keeps the running sums needed for a linear regression of value against time over a sliding window,
+so each new sample costs O(1) rather than a full regression over the window.
+Times and values are held relative to a reference sample from the window, and the caller should rebuild the sums
+from the raw window every so often (see updates), so add/remove doesn't build up floating point error.
+*/
+type rollingRegression struct {
+	n             int
+	reft          time.Time
+	refv          float64
+	st, sv        float64
+	stt, svv, stv float64
+	updates       int /// adds and removes since the last rebuild
+}
+
+func (p *rollingRegression) add(t time.Time, v float64) {
+	if p.n == 0 {
+		/// the first sample is the reference - otherwise it's the zero time, and the time since then overflows
+		*p = rollingRegression{reft: t, refv: v, updates: p.updates}
+	}
+	x := float64(t.Sub(p.reft))
+	y := v - p.refv
+	p.n++
+	p.st += x
+	p.sv += y
+	p.stt += x * x
+	p.svv += y * y
+	p.stv += x * y
+	p.updates++
+}
+
+func (p *rollingRegression) remove(t time.Time, v float64) {
+	x := float64(t.Sub(p.reft))
+	y := v - p.refv
+	p.n--
+	p.st -= x
+	p.sv -= y
+	p.stt -= x * x
+	p.svv -= y * y
+	p.stv -= x * y
+	p.updates++
+}
+
+func (p *rollingRegression) rebuild(data []storables.StorableFloat, sampletime []storables.StorableTime) {
+	*p = rollingRegression{}
+	if len(data) == 0 {
+		return
+	}
+	p.reft = time.Time(sampletime[0])
+	p.refv = float64(data[0])
+	for i := range data {
+		p.add(time.Time(sampletime[i]), float64(data[i]))
+	}
+	p.updates = 0
+}
+
+// / Call after pushing a new sample onto data - slides the regression window on by one
+func (p *rollingRegression) slide(window int, data *managedslice.Slice[storables.StorableFloat],
+	sampletime *managedslice.Slice[storables.StorableTime]) {
+	samples := data.Len()
+	wndlen := samples
+	if wndlen > window {
+		wndlen = window
+	}
+	prevlen := samples - 1
+	if prevlen > window {
+		prevlen = window
+	}
+	if p.n != prevlen || p.updates >= 4*window {
+		/// out of step (e.g. just loaded from storage) or due a refresh
+		p.rebuild(data.Items()[samples-wndlen:], sampletime.Items()[samples-wndlen:])
+		return
+	}
+	p.add(time.Time(sampletime.FromBack(0)), float64(data.FromBack(0)))
+	if samples > window {
+		p.remove(time.Time(sampletime.FromBack(window)), float64(data.FromBack(window)))
+	}
+}
+
+/*
+*
+The same as slide, but the window is all the samples within window (a duration) of the latest one, so it can be any
+length. Call after pushing a new sample onto data (and dropping any expired samples from the front).
+*/
+func (p *rollingRegression) slideDuration(window time.Duration, data *managedslice.Slice[storables.StorableFloat],
+	sampletime *managedslice.Slice[storables.StorableTime]) {
+	samples := data.Len()
+	latest := time.Time(sampletime.FromBack(0))
+	oldest := latest.Add(-window)
+	if p.n > samples-1 || (p.n == 0 && samples > 1) || p.updates >= 4*(p.n+1) {
+		/// out of step (e.g. just loaded from storage, or the window was dropped from data) or due a refresh
+		wndlen := 0
+		for wndlen < samples && time.Time(sampletime.FromBack(wndlen)).After(oldest) {
+			wndlen++
+		}
+		p.rebuild(data.Items()[samples-wndlen:], sampletime.Items()[samples-wndlen:])
+		return
+	}
+	p.add(latest, float64(data.FromBack(0)))
+	for p.n > 0 && !time.Time(sampletime.FromBack(p.n-1)).After(oldest) {
+		p.remove(time.Time(sampletime.FromBack(p.n-1)), float64(data.FromBack(p.n-1)))
+	}
+	if !p.reft.After(oldest) {
+		/// the reference has left the window - after a gap the window can be a few samples a long way from it,
+		/// which loses too much precision
+		p.rebuild(data.Items()[samples-p.n:], sampletime.Items()[samples-p.n:])
+	}
+}
+
+// / regression over the window that ends with the last sample in sampletime
+func (p *rollingRegression) regressionOver(sampletime *managedslice.Slice[storables.StorableTime],
+	minprice, maxprice float64) (alpha, beta, rsqrd float64) {
+	firstsampletime := time.Time(sampletime.FromBack(p.n - 1))
+	lastsampletime := time.Time(sampletime.FromBack(0))
+	return p.regression(firstsampletime, lastsampletime, minprice, maxprice)
+}
+
+/*
+*
+Gives the same alpha, beta and R squared as a least squares fit of y against x, where
+x = (t - firsttime) / average time between samples in the window
+y = (v - minprice) / (maxprice - minprice)
+firsttime and lasttime are the times of the oldest and newest samples in the window.
+If there's no spread in x or y, R squared is NaN (as it would be from gonum).
+*/
+func (p *rollingRegression) regression(firsttime, lasttime time.Time, minprice, maxprice float64) (alpha, beta, rsqrd float64) {
+	n := float64(p.n)
+	avgtime := float64(lasttime.Sub(firsttime)) / n
+	pricerange := maxprice - minprice
+	meant := p.st / n
+	meanv := p.sv / n
+	sxx := p.stt - p.st*meant
+	if p.n < 2 || avgtime == 0 || pricerange == 0 || sxx <= p.stt*REGRESSION_TOLERANCE {
+		return math.NaN(), math.NaN(), math.NaN()
+	}
+	syy := p.svv - p.sv*meanv
+	sxy := p.stv - p.st*meanv
+
+	beta = (sxy / sxx) * avgtime / pricerange
+	meanx := (meant - float64(firsttime.Sub(p.reft))) / avgtime
+	meany := (meanv + p.refv - minprice) / pricerange
+	if syy <= p.svv*REGRESSION_TOLERANCE {
+		/// flat data in the window
+		return meany, 0, math.NaN()
+	}
+	alpha = meany - beta*meanx
+	rsqrd = (sxy * sxy) / (sxx * syy)
+	return alpha, beta, rsqrd
+}
+
+/*
+*
+The standard error, t statistic and two sided p-value of the slope of a straight line fit over n points.
+These only depend on R squared and n (t = r * sqrt((n - 2) / (1 - r^2))), so they come for free from the rolling sums.
+They're NaN if there aren't at least 3 points or there's no R squared.
+*/
+func slopeSignificance(beta, rsqrd float64, n int) (stderr, tstat, pvalue float64) {
+	if n < 3 || math.IsNaN(rsqrd) || math.IsNaN(beta) {
+		return math.NaN(), math.NaN(), math.NaN()
+	}
+	df := float64(n - 2)
+	if rsqrd >= 1 {
+		/// a perfect fit
+		return 0, math.Copysign(math.Inf(1), beta), 0
+	}
+	tstat = math.Copysign(math.Sqrt(rsqrd*df/(1-rsqrd)), beta)
+	stderr = math.NaN()
+	if tstat != 0 {
+		stderr = beta / tstat
+	}
+	tdist := distuv.StudentsT{Mu: 0, Sigma: 1, Nu: df}
+	pvalue = 2 * tdist.Survival(math.Abs(tstat))
+	return stderr, tstat, pvalue
+}
@@ -0,0 +1,191 @@
+package signals
+
+import (
+	"github.com/paul-at-nangalan/signals/signals/storables"
+	"golang.org/x/exp/rand"
+	"gonum.org/v1/gonum/stat"
+	"gonum.org/v1/gonum/stat/distuv"
+	"gotest.tools/v3/assert"
+	"math"
+	"testing"
+	"time"
+)
+
+// / The full regression over the window, as SigCurve used to do it on every sample
+func gonumRegression(sig *SigCurve) (alpha, beta, rsqrd float64) {
+	wnd := sig.windowLen()
+	data := sig.samples.variance.Items()[sig.samples.variance.Len()-wnd:]
+	sampletime := sig.samples.variancetime.Items()[sig.samples.variancetime.Len()-wnd:]
+	minprice, maxprice := scanPriceRange(sig)
+	firstsampletime := time.Time(sampletime[0])
+	y := make([]float64, len(data))
+	x := make([]float64, len(data))
+	timerange := time.Time(sampletime[len(sampletime)-1]).Sub(firstsampletime)
+	avgtime := float64(timerange) / float64(len(sampletime))
+	for i := range data {
+		x[i] = float64(time.Time(sampletime[i]).Sub(firstsampletime)) / avgtime
+		y[i] = (float64(data[i]) - minprice) / (maxprice - minprice)
+	}
+	alpha, beta = stat.LinearRegression(x, y, nil, false)
+	rsqrd = stat.RSquared(x, y, nil, alpha, beta)
+	return alpha, beta, rsqrd
+}
+
+func assertClose(t *testing.T, got, exp float64, msg ...any) {
+	t.Helper()
+	if math.IsNaN(exp) {
+		if !math.IsNaN(got) {
+			t.Fatal("Expected NaN, got ", got, msg)
+		}
+		return
+	}
+	if !(math.Abs(got-exp) <= 1e-7*math.Max(1, math.Abs(exp))) { /// written this way round so NaN fails
+		t.Fatal("Mismatch ", got, " != ", exp, msg)
+	}
+}
+
+func TestRollingRegression_MatchesGonum(t *testing.T) {
+	src := rand.NewSource(42)
+	rnd := rand.New(src)
+	sig := NewSigCurve(500, 400, 0.35, 20, 0.45)
+	sampletime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5000; i++ {
+		/// irregular ticks, a trend, noise and the odd flat patch
+		sampletime = sampletime.Add(time.Duration(1+rnd.Intn(5000)) * time.Millisecond)
+		val := 1000 + float64(i)*0.1 + rnd.NormFloat64()*5
+		if i%700 < 30 {
+			val = 1000
+		}
+		sig.AddVarianceSample(val, sampletime)
+		if sig.samples.variance.Len() < 2 {
+			continue
+		}
+		alpha, beta, rsqrd := sig.linearRegressionFromSums()
+		expalpha, expbeta, exprsqrd := gonumRegression(sig)
+		assertClose(t, beta, expbeta, "beta at ", i)
+		assertClose(t, rsqrd, exprsqrd, "rsqrd at ", i)
+		if !math.IsNaN(exprsqrd) {
+			assertClose(t, alpha, expalpha, "alpha at ", i)
+		}
+	}
+}
+
+func TestRollingRegression_Rebuild(t *testing.T) {
+	sig := NewSigCurve(500, 400, 0.35, 20, 0.45)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 100; i++ {
+		sig.AddVarianceSample(math.Sin(float64(i)/10), start.Add(time.Duration(i)*time.Second))
+	}
+	/// as if just loaded from storage
+	sig.reg = rollingRegression{}
+	sig.AddVarianceSample(0.5, start.Add(100*time.Second))
+	assert.Equal(t, sig.reg.n, 20)
+	_, beta, rsqrd := sig.linearRegressionFromSums()
+	_, expbeta, exprsqrd := gonumRegression(sig)
+	assertClose(t, beta, expbeta)
+	assertClose(t, rsqrd, exprsqrd)
+}
+
+func TestRollingRegression_NoAlloc(t *testing.T) {
+	sig := NewSigCurve(500, 400, 0.35, 20, 0.45)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	i := 0
+	allocs := testing.AllocsPerRun(2000, func() {
+		sig.samples.variance.PushAndResize(storables.StorableFloat(math.Sin(float64(i) / 10)))
+		sig.samples.variancetime.PushAndResize(storables.StorableTime(start.Add(time.Duration(i) * time.Second)))
+		sig.updateRegression()
+		sig.reg.regression(start, start.Add(time.Duration(i)*time.Second), -1, 1)
+		i++
+	})
+	assert.Equal(t, allocs, float64(0), "Regression update should not allocate")
+}
+
+func BenchmarkSigCurve_AddVarianceSample(b *testing.B) {
+	sig := NewSigCurve(1000, 500, 0.35, 100, 0.45)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sig.AddVarianceSample(math.Sin(float64(i)/100), start.Add(time.Duration(i)*time.Second))
+	}
+}
+
+func TestRollingRegression_Duration(t *testing.T) {
+	rnd := rand.New(rand.NewSource(9))
+	sig, err := NewSigCurveFromConfig(SigCurveConfig{NumSamples: 2000, MinDataPoints: 100, MinSlope: 0.35, Window: 5,
+		MinRSqrd: 0.45, WindowDuration: 30 * time.Second, HistoryDuration: 10 * time.Minute})
+	assert.NilError(t, err)
+	sampletime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5000; i++ {
+		/// bursts of fast ticks and long gaps
+		gap := time.Duration(1+rnd.Intn(500)) * time.Millisecond
+		if i%200 < 10 {
+			gap = time.Duration(20+rnd.Intn(40)) * time.Second
+		}
+		sampletime = sampletime.Add(gap)
+		sig.AddVarianceSample(1000+float64(i)*0.1+rnd.NormFloat64()*5, sampletime)
+
+		/// the window is exactly the samples in the last 30s
+		inwindow := 0
+		for j := 0; j < sig.samples.variancetime.Len(); j++ {
+			if sampletime.Sub(time.Time(sig.samples.variancetime.FromBack(j))) < 30*time.Second {
+				inwindow++
+			}
+		}
+		assert.Equal(t, sig.windowLen(), inwindow, "window len at ", i)
+		if time.Time(sig.samples.variancetime.At(0)).Before(sampletime.Add(-10 * time.Minute)) {
+			t.Fatal("Sample older than the history kept at ", i)
+		}
+		minprice, maxprice := scanPriceRange(sig)
+		assert.Equal(t, sig.samples.extrema.min(), minprice, "min at ", i)
+		assert.Equal(t, sig.samples.extrema.max(), maxprice, "max at ", i)
+		if inwindow < 2 {
+			continue
+		}
+		_, beta, rsqrd := sig.linearRegressionFromSums()
+		_, expbeta, exprsqrd := gonumRegression(sig)
+		assertClose(t, beta, expbeta, "beta at ", i)
+		assertClose(t, rsqrd, exprsqrd, "rsqrd at ", i)
+	}
+	if sig.samples.variance.Len() >= 2000 {
+		t.Error("Expected the history duration to keep fewer samples than the max ", sig.samples.variance.Len())
+	}
+}
+
+func TestSlopeSignificance(t *testing.T) {
+	rnd := rand.New(rand.NewSource(13))
+	for _, trend := range []float64{0, 0.01, 0.1, 1} {
+		x := make([]float64, 30)
+		y := make([]float64, 30)
+		for i := range x {
+			x[i] = float64(i)
+			y[i] = trend*x[i] + rnd.NormFloat64()
+		}
+		alpha, beta := stat.LinearRegression(x, y, nil, false)
+		rsqrd := stat.RSquared(x, y, nil, alpha, beta)
+		/// the textbook way, from the residuals
+		ssres := 0.0
+		for i := range x {
+			res := y[i] - (alpha + beta*x[i])
+			ssres += res * res
+		}
+		meanx := stat.Mean(x, nil)
+		sxx := 0.0
+		for i := range x {
+			sxx += (x[i] - meanx) * (x[i] - meanx)
+		}
+		expstderr := math.Sqrt(ssres / float64(len(x)-2) / sxx)
+		exptstat := beta / expstderr
+		exppvalue := 2 * distuv.StudentsT{Mu: 0, Sigma: 1, Nu: float64(len(x) - 2)}.Survival(math.Abs(exptstat))
+
+		stderr, tstat, pvalue := slopeSignificance(beta, rsqrd, len(x))
+		assertClose(t, stderr, expstderr, "stderr for trend ", trend)
+		assertClose(t, tstat, exptstat, "tstat for trend ", trend)
+		assertClose(t, pvalue, exppvalue, "pvalue for trend ", trend)
+	}
+	_, tstat, pvalue := slopeSignificance(0.5, 1, 10)
+	assert.Equal(t, tstat, math.Inf(1))
+	assert.Equal(t, pvalue, 0.0)
+	_, _, pvalue = slopeSignificance(0.5, 0.9, 2)
+	assert.Assert(t, math.IsNaN(pvalue), "Need at least 3 points")
+}
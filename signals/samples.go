@@ -0,0 +1,113 @@
+package signals
+
+import (
+	"fmt"
+	"github.com/paul-at-nangalan/short-term-store/store"
+	"github.com/paul-at-nangalan/signals/dataplot"
+	"github.com/paul-at-nangalan/signals/managedslice"
+	"github.com/paul-at-nangalan/signals/signals/storables"
+	"log"
+	"math"
+	"time"
+)
+
+/*
+*
+sampleBuffer is the samples (and their times) that the regressions run over, with their rolling min and max.
+A SigCurve has its own, a MultiSigCurve shares one between the SigCurves for each of its windows.
+*/
+type sampleBuffer struct {
+	variance     *managedslice.Slice[storables.StorableFloat]
+	variancetime *managedslice.Slice[storables.StorableTime]
+	extrema      rollingExtrema
+}
+
+func newSampleBuffer(numsamples int) *sampleBuffer {
+	return &sampleBuffer{
+		variance:     managedslice.NewSlice[storables.StorableFloat](0, numsamples), ///we only need 2 * window here - but keep the rest for now for debug
+		variancetime: managedslice.NewSlice[storables.StorableTime](0, numsamples),  ///do LR against time on the x axis
+		extrema:      newRollingExtrema(numsamples + 1),
+	}
+}
+
+/*
+*
+Applies policy to a sample - variance is the sample as it was passed in, before it was shifted, for the error.
+bad is whether it's NaN/Inf, keep whether to go on and push it (for BadSampleCarryForward it's been replaced by the last
+good sample) and err is only set for BadSampleError.
+*/
+func (p *sampleBuffer) check(variance, sample float64, t time.Time, policy BadSamplePolicy) (checked float64, bad, keep bool, err error) {
+	if !math.IsNaN(sample) && !math.IsInf(sample, 0) {
+		return sample, false, true, nil
+	}
+	switch policy {
+	case BadSampleError:
+		return sample, true, false, fmt.Errorf("%w: %v at %v", ErrBadSample, variance, t)
+	case BadSampleCarryForward:
+		if p.variance.Len() == 0 {
+			return sample, true, false, nil
+		}
+		return float64(p.variance.FromBack(0)), true, true, nil
+	}
+	return sample, true, false, nil
+}
+
+// / Push a sample, dropping any older than history (if it's set). numsamples is the most that are kept
+func (p *sampleBuffer) push(sample float64, t time.Time, numsamples int, history time.Duration) {
+	/// rebuilds the rolling min/max if it's out of step (e.g. just loaded from storage)
+	p.extrema.sync(p.variance, numsamples+1)
+	p.variance.PushAndResize(storables.StorableFloat(sample))
+	p.variancetime.PushAndResize(storables.StorableTime(t))
+	p.expireHistory(t, history)
+	p.extrema.push(sample)
+	p.extrema.expire(p.variance.Len())
+}
+
+func (p *sampleBuffer) expireHistory(latest time.Time, history time.Duration) {
+	if history <= 0 {
+		return
+	}
+	oldest := latest.Add(-history)
+	expired := 0
+	for expired < p.variancetime.Len()-1 && !time.Time(p.variancetime.At(expired)).After(oldest) {
+		expired++
+	}
+	p.variance.DropFront(expired)
+	p.variancetime.DropFront(expired)
+}
+
+func (p *sampleBuffer) Len() int {
+	return p.variance.Len()
+}
+
+// / The min and max over all the samples - kept up to date by the rolling min/max rather than scanning it all
+func (p *sampleBuffer) priceRange() (minprice, maxprice float64) {
+	return p.extrema.min(), p.extrema.max()
+}
+
+func (p *sampleBuffer) store(fs store.Store, name string) {
+	fs.Store(name+"-variance", p.variance)
+	fs.Store(name+"-variancetime", p.variancetime)
+}
+
+func (p *sampleBuffer) retrieve(fs store.Store, name string, maxage time.Duration) (isvalid bool) {
+	p.variance, isvalid = managedslice.NewSliceFromStore[storables.StorableFloat](name+"-variance", fs, storables.StorableFloat(0), maxage)
+	if !isvalid {
+		return false
+	}
+	p.variancetime, isvalid = managedslice.NewSliceFromStore[storables.StorableTime](name+"-variancetime", fs, storables.StorableTime{}, maxage)
+	if !isvalid {
+		return false
+	}
+	if p.variancetime.Len() != p.variance.Len() {
+		/// saved at different times (e.g. read while a save was being written) - the regression needs them in step
+		log.Println("Stored samples and sample times don't match ", p.variance.Len(), p.variancetime.Len())
+		return false
+	}
+	return true
+}
+
+func (p *sampleBuffer) plot() {
+	fmt.Println("Raw data")
+	dataplot.PlotManagedSlice(p.variance, 80, 40)
+}
@@ -3,6 +3,7 @@ package signals
 import (
 	"bytes"
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"github.com/paul-at-nangalan/errorhandler/handlers"
 	"github.com/paul-at-nangalan/short-term-store/store"
@@ -10,7 +11,6 @@ import (
 	"github.com/paul-at-nangalan/signals/managedslice"
 	"github.com/paul-at-nangalan/signals/signals/storables"
 	perfstats "github.com/paul-at-nangalan/stats/stats"
-	"gonum.org/v1/gonum/stat"
 	"io"
 	"log"
 	"math"
@@ -23,12 +23,50 @@ const (
 	LOGDBG  = iota
 )
 
+// / What to do with NaN/Inf samples passed to AddVarianceSample
+type BadSamplePolicy int
+
+const (
+	BadSampleDrop         BadSamplePolicy = iota /// ignore the sample
+	BadSampleCarryForward                        /// use the last good sample instead (dropped if there isn't one yet)
+	BadSampleError                               /// ignore the sample and return ErrBadSample
+)
+
+var ErrBadSample = errors.New("sample is NaN or Inf")
+
+// / How the slopes in the variance curve are turned into buy/sell signals
+type TrendMode int
+
+const (
+	TrendSlope        TrendMode = iota /// signal while the latest slope is steeper than minslope
+	TrendTurningPoint                  /// signal only when the slope changes sign - see turningPoint
+	TrendCurvature                     /// signal on a slowing trend that's about to turn - see curvature, needs Degree >= 2
+)
+
+// / Options added after the original set of parameters. gob matches struct fields by name, so adding more here
+// / doesn't stop data stored by an older version from loading
+type curveOptions struct {
+	BadSamples   BadSamplePolicy
+	Mode         TrendMode
+	TurnConfirm  int
+	TurnMinSlope float64
+	Degree       int
+	MinCurvature float64
+	Debounce     *DebounceConfig
+
+	WindowDuration  time.Duration
+	HistoryDuration time.Duration
+	SlopeConfidence float64
+
+	AdaptiveQuantile float64
+	AdaptiveSamples  int
+}
+
 type SigCurve struct {
-	variance            *managedslice.Slice
-	variancetime        *managedslice.Slice
-	variancecurve       *managedslice.Slice
-	variancecurvedbg    *managedslice.Slice
-	rsqrd               *managedslice.Slice
+	samples             *sampleBuffer
+	variancecurve       *managedslice.Slice[storables.StorableFloat]
+	variancecurvedbg    *managedslice.Slice[storables.StorableFloat]
+	rsqrd               *managedslice.Slice[storables.StorableFloat]
 	sigbuyonvariance    bool
 	sigsellonvariance   bool
 	numorderbooksamples int
@@ -46,7 +84,24 @@ type SigCurve struct {
 	statsvaliddata       *perfstats.Counter
 	statslopedata        *perfstats.BucketCounter
 	statrsqrddata        *perfstats.BucketCounter
+	statsrejected        *perfstats.Counter
+	stattstat            *perfstats.BucketCounter
+	statpvalue           *perfstats.BucketCounter
+	statsinsignificant   *perfstats.Counter
 	loglevel             int
+	rejected             int64
+
+	reg      rollingRegression
+	opts     curveOptions
+	clock    Clock
+	debounce *Debouncer
+	events   eventSource
+	lastfit  PolyFit
+	fitx     []float64 /// reused for the polynomial fit
+	fity     []float64
+
+	absslopes         rollingQuantile /// only used for AdaptiveQuantile
+	effectiveminslope float64
 
 	datastore    store.Store
 	storagename  string
@@ -70,44 +125,208 @@ func NewSigCurve(numsamples int, mindatapoints int, minslope float64, window int
 	return NewSigCurveWithFactor(numsamples, mindatapoints, minslope, window, minrsqrd, 1)
 }
 
+// / Only the original checks are made (see SigCurveConfig.validateSizes) - NewSigCurveFromConfig is stricter
 func NewSigCurveWithFactor(numsamples int, mindatapoints int, minslope float64, window int, minrsqrd float64,
 	shiftfactor float64) *SigCurve {
-	if mindatapoints >= numsamples {
-		log.Panic("Splitpoint must be less than num data samples ", mindatapoints, ">=", numsamples)
+	cfg := SigCurveConfig{
+		NumSamples:    numsamples,
+		MinDataPoints: mindatapoints,
+		MinSlope:      minslope,
+		Window:        window,
+		MinRSqrd:      minrsqrd,
+		ShiftFactor:   shiftfactor,
+	}
+	if err := cfg.validateSizes(); err != nil {
+		log.Panic(err)
+	}
+	return newSigCurve(cfg, newSampleBuffer(numsamples))
+}
+
+/*
+*
+SigCurveConfig holds the same parameters as NewSigCurveWithFactor - see NewSigCurve for what each one means.
+A ShiftFactor of 0 is treated as 1.
+*/
+type SigCurveConfig struct {
+	NumSamples    int
+	MinDataPoints int
+	MinSlope      float64
+	Window        int
+	MinRSqrd      float64
+	ShiftFactor   float64
+	Clock         Clock /// only used to decide when to save - defaults to WallClock
+	BadSamples    BadSamplePolicy
+
+	/// For TrendTurningPoint - how many slopes there must be on each side of the turn, and the steepest slope on
+	/// each side must be at least TurnMinSlope
+	Mode         TrendMode
+	TurnConfirm  int
+	TurnMinSlope float64
+
+	/// Degree 0 or 1 fits a straight line over the window (using running sums, so it's cheap). Higher degrees fit a
+	/// polynomial by least squares and use its slope at the end of the window - this goes through the whole window
+	/// on every sample. For TrendCurvature, MinCurvature is the smallest second derivative (in the same units as the
+	/// slope, per sample) that counts as the trend slowing down
+	Degree       int
+	MinCurvature float64
+
+	/// Optional - stops the signals chattering. In TrendSlope mode, the bands (if set) are applied to the latest
+	/// slope, otherwise it just confirms and cools down the raw signal. A turning point only signals for one sample,
+	/// so only the Cooldown is allowed in that mode - confirming it would stop it ever signalling
+	Debounce *DebounceConfig
+
+	/// Optional - for irregular data. With a WindowDuration, the regression is over all the samples within that
+	/// duration of the latest one, and Window becomes the minimum number of samples there must be in it.
+	/// With a HistoryDuration, samples older than that are dropped (NumSamples is still the most that are kept).
+	WindowDuration  time.Duration
+	HistoryDuration time.Duration
+
+	/// Optional - only accept a slope if it's significantly different from flat at this confidence level
+	/// (e.g. 0.95), as well as having R squared over MinRSqrd. Only for straight line fits (Degree 0 or 1)
+	SlopeConfidence float64
+
+	/// Optional - derive the min slope from the data. Once there have been AdaptiveSamples regressions, the min slope
+	/// is the AdaptiveQuantile (e.g. 0.8) of the size of the last AdaptiveSamples slopes, but never less than MinSlope
+	AdaptiveQuantile float64
+	AdaptiveSamples  int
+}
+
+func (c SigCurveConfig) Validate() error {
+	if c.NumSamples <= 0 || c.Window <= 0 {
+		return fmt.Errorf("num samples and window must be positive, got %d and %d", c.NumSamples, c.Window)
+	}
+	if c.MinDataPoints < 0 {
+		return fmt.Errorf("min data points is negative %d", c.MinDataPoints)
+	}
+	if c.MinSlope < 0 {
+		return fmt.Errorf("min slope is negative %v", c.MinSlope)
+	}
+	if c.BadSamples < BadSampleDrop || c.BadSamples > BadSampleError {
+		return fmt.Errorf("unknown bad sample policy %d", c.BadSamples)
+	}
+	switch c.Mode {
+	case TrendSlope:
+	case TrendTurningPoint:
+		if c.TurnConfirm <= 0 || c.TurnMinSlope < 0 {
+			return fmt.Errorf("turning point mode needs a positive confirmation length and a min slope >= 0, got %d and %v",
+				c.TurnConfirm, c.TurnMinSlope)
+		}
+		if 2*c.TurnConfirm > (c.NumSamples/c.Window)+1 {
+			return fmt.Errorf("the variance curve only holds %d slopes - not enough to confirm %d each side of a turning point",
+				(c.NumSamples/c.Window)+1, c.TurnConfirm)
+		}
+	case TrendCurvature:
+		if c.Degree < 2 || c.MinCurvature <= 0 {
+			return fmt.Errorf("curvature mode needs a degree of at least 2 and a positive min curvature, got %d and %v",
+				c.Degree, c.MinCurvature)
+		}
+	default:
+		return fmt.Errorf("unknown trend mode %d", c.Mode)
+	}
+	if c.Degree < 0 || c.Degree >= c.Window {
+		return fmt.Errorf("the polynomial degree must be between 0 and the window - 1, got %d with a window of %d",
+			c.Degree, c.Window)
+	}
+	if c.Debounce != nil {
+		if err := c.Debounce.Validate(); err != nil {
+			return err
+		}
+		if c.Mode == TrendTurningPoint && (c.Debounce.Confirm > 1 || c.Debounce.hasBands()) {
+			return fmt.Errorf("a turning point only signals for one sample - only the debounce cooldown can be used "+
+				"with it, got a confirmation of %d and bands %v", c.Debounce.Confirm, c.Debounce.hasBands())
+		}
+	}
+	if c.WindowDuration < 0 || c.HistoryDuration < 0 {
+		return fmt.Errorf("window and history durations can't be negative, got %v and %v", c.WindowDuration,
+			c.HistoryDuration)
 	}
-	if window >= numsamples-mindatapoints {
-		log.Panic("The window should be much smaller than the difference between the number of samples and the mindatapoints")
+	if c.WindowDuration > 0 && c.HistoryDuration > 0 && c.HistoryDuration < c.WindowDuration {
+		return fmt.Errorf("the history duration %v must be at least the window duration %v", c.HistoryDuration,
+			c.WindowDuration)
 	}
-	if (mindatapoints/window)+1 > (numsamples/window)+1 {
-		log.Panicln("Min data points is less than max variance curve length - impossible to generate signals",
-			mindatapoints, "/", window+1, " = ", (mindatapoints/window)+1,
-			" and ", numsamples, "/", window+1, "=", (numsamples/window)+1)
+	if c.SlopeConfidence < 0 || c.SlopeConfidence >= 1 {
+		return fmt.Errorf("slope confidence must be in [0, 1), got %v", c.SlopeConfidence)
+	}
+	if c.SlopeConfidence > 0 && c.Degree >= 2 {
+		return fmt.Errorf("slope confidence is only for straight line fits, not degree %d", c.Degree)
+	}
+	if c.AdaptiveQuantile < 0 || c.AdaptiveQuantile >= 1 {
+		return fmt.Errorf("adaptive quantile must be in [0, 1), got %v", c.AdaptiveQuantile)
+	}
+	if c.AdaptiveQuantile > 0 && c.AdaptiveSamples <= 0 {
+		return fmt.Errorf("adaptive min slope needs a positive number of samples, got %d", c.AdaptiveSamples)
+	}
+	return c.validateSizes()
+}
+
+// / The checks NewSigCurveWithFactor has always made. The window must already be known to be positive
+func (c SigCurveConfig) validateSizes() error {
+	if c.MinDataPoints >= c.NumSamples {
+		return fmt.Errorf("splitpoint must be less than num data samples %d >= %d", c.MinDataPoints, c.NumSamples)
 	}
+	if c.Window >= c.NumSamples-c.MinDataPoints {
+		return fmt.Errorf("the window should be much smaller than the difference between the number of samples and the mindatapoints %d >= %d - %d",
+			c.Window, c.NumSamples, c.MinDataPoints)
+	}
+	if (c.MinDataPoints/c.Window)+1 > (c.NumSamples/c.Window)+1 {
+		return fmt.Errorf("min data points is less than max variance curve length - impossible to generate signals %d/%d = %d and %d/%d = %d",
+			c.MinDataPoints, c.Window, (c.MinDataPoints/c.Window)+1, c.NumSamples, c.Window, (c.NumSamples/c.Window)+1)
+	}
+	return nil
+}
+
+func NewSigCurveFromConfig(cfg SigCurveConfig) (*SigCurve, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return newSigCurve(cfg, newSampleBuffer(cfg.NumSamples)), nil
+}
+
+// / cfg must have been checked (see NewSigCurveWithFactor). samples can be shared with other SigCurves, as long as only one of them pushes onto it
+func newSigCurve(cfg SigCurveConfig, samples *sampleBuffer) *SigCurve {
+	numsamples := cfg.NumSamples
+	mindatapoints := cfg.MinDataPoints
+	minslope := cfg.MinSlope
+	window := cfg.Window
+	shiftfactor := cfg.ShiftFactor
 	if shiftfactor == 0 {
 		shiftfactor = 1
 	}
-	slopestatsrange := minslope * 2
-	slopestatsstep := minslope / 100
 	sc := &SigCurve{
-		variance:             managedslice.NewManagedSlice(0, numsamples),            ///we only need 2 * window here - but keep the rest for now for debug
-		variancetime:         managedslice.NewManagedSlice(0, numsamples),            ///do LR against time on the x axis
-		variancecurve:        managedslice.NewManagedSlice(0, (numsamples/window)+1), ///we need numsamples / window
-		variancecurvedbg:     managedslice.NewManagedSlice(0, numsamples),            /// for printing
-		rsqrd:                managedslice.NewManagedSlice(0, numsamples),            /// for printing
-		shiftfactor:          shiftfactor,
-		mindatapoints:        (mindatapoints / window) + 1, /// divde by the window to get it in block averages
-		numorderbooksamples:  numsamples,
-		minslope:             minslope,
-		statsvariancebuysig:  perfstats.NewCounter("variance-buy-signalled"),
-		statsvariancesellsig: perfstats.NewCounter("variance-sell-signalled"),
-		window:               window,
-		wndcounter:           0,
-		averagewndsize:       ((numsamples - mindatapoints) / window) + 1,
-		minrsqrd:             minrsqrd,
-		statslopedata:        perfstats.NewBucketCounter(-1*slopestatsrange, slopestatsrange, slopestatsstep, "slope-stats"),
-		statrsqrddata:        perfstats.NewBucketCounter(-1, 1, 0.05, "rsqrd-stats"),
-		statsvaliddata:       perfstats.NewCounter("valid-data-sample"),
+		samples:             samples,
+		variancecurve:       managedslice.NewSlice[storables.StorableFloat](0, (numsamples/window)+1), ///we need numsamples / window
+		variancecurvedbg:    managedslice.NewSlice[storables.StorableFloat](0, numsamples),            /// for printing
+		rsqrd:               managedslice.NewSlice[storables.StorableFloat](0, numsamples),            /// for printing
+		shiftfactor:         shiftfactor,
+		mindatapoints:       (mindatapoints / window) + 1, /// divde by the window to get it in block averages
+		numorderbooksamples: numsamples,
+		minslope:            minslope,
+		window:              window,
+		wndcounter:          0,
+		averagewndsize:      ((numsamples - mindatapoints) / window) + 1,
+		minrsqrd:            cfg.MinRSqrd,
+		clock:               cfg.Clock,
+		opts: curveOptions{
+			BadSamples:   cfg.BadSamples,
+			Mode:         cfg.Mode,
+			TurnConfirm:  cfg.TurnConfirm,
+			TurnMinSlope: cfg.TurnMinSlope,
+			Degree:       cfg.Degree,
+			MinCurvature: cfg.MinCurvature,
+			Debounce:     cfg.Debounce,
+
+			WindowDuration:  cfg.WindowDuration,
+			HistoryDuration: cfg.HistoryDuration,
+			SlopeConfidence: cfg.SlopeConfidence,
+
+			AdaptiveQuantile: cfg.AdaptiveQuantile,
+			AdaptiveSamples:  cfg.AdaptiveSamples,
+		},
 	}
+	sc.effectiveminslope = minslope
+	sc.setupStats("")
+	sc.setupAdaptive()
+	sc.setupDebounce()
 	return sc
 }
 
@@ -132,6 +351,10 @@ func (p *SigCurve) Encode(buffer io.Writer) {
 	handlers.PanicOnError(err)
 	err = enc.Encode(p.saveduration)
 	handlers.PanicOnError(err)
+	err = enc.Encode(p.opts)
+	handlers.PanicOnError(err)
+	err = enc.Encode(p.effectiveminslope)
+	handlers.PanicOnError(err)
 
 	buffer.Write(params.Bytes())
 }
@@ -156,49 +379,105 @@ func (p *SigCurve) Decode(buffer io.Reader) {
 	handlers.PanicOnError(err)
 	err = enc.Decode(&p.saveduration)
 	handlers.PanicOnError(err)
+	err = enc.Decode(&p.opts)
+	if err != io.EOF { /// stored before there were any options
+		handlers.PanicOnError(err)
+	}
+	p.effectiveminslope = p.minslope
+	if err == nil {
+		err = enc.Decode(&p.effectiveminslope)
+		if err != io.EOF { /// stored before the adaptive min slope
+			handlers.PanicOnError(err)
+		}
+	}
+	p.setupDebounce()
+	p.setupAdaptive()
+}
+
+func (p *SigCurve) setupAdaptive() {
+	if p.opts.AdaptiveQuantile > 0 {
+		p.absslopes = newRollingQuantile(p.opts.AdaptiveSamples)
+	}
+}
+
+// / Record the slope from the latest regression, and move the min slope on if it's adaptive
+func (p *SigCurve) adaptMinSlope(slope float64) {
+	if p.opts.AdaptiveQuantile <= 0 || math.IsNaN(slope) {
+		return
+	}
+	p.absslopes.push(math.Abs(slope))
+	if p.absslopes.full() {
+		p.effectiveminslope = math.Max(p.minslope, p.absslopes.quantile(p.opts.AdaptiveQuantile))
+	}
+}
+
+// / The min slope in use - MinSlope unless it's adaptive
+func (p *SigCurve) EffectiveMinSlope() float64 {
+	return p.effectiveminslope
+}
+
+// / The debouncer's state isn't stored - after a restart it has to confirm the signal again
+func (p *SigCurve) setupDebounce() {
+	p.debounce = nil
+	if p.opts.Debounce != nil {
+		p.debounce = &Debouncer{cfg: *p.opts.Debounce}
+	}
 }
 
 func (p *SigCurve) storeData() {
-	if p.datastore == nil || p.lastsaved.Add(p.saveduration).After(time.Now()) {
+	now := p.now()
+	if p.datastore == nil || p.lastsaved.Add(p.saveduration).After(now) {
 		return
 	}
-	p.lastsaved = time.Now()
-	p.datastore.Store(p.storagename+"-variance", p.variance)
-	p.datastore.Store(p.storagename+"-variancetime", p.variancetime)
-	p.datastore.Store(p.storagename+"-variancecurve", p.variancecurve)
-	p.datastore.Store(p.storagename+"-variancecurvedbg", p.variancecurvedbg)
-	p.datastore.Store(p.storagename+"-rsqrd", p.rsqrd)
+	p.lastsaved = now
+	p.samples.store(p.datastore, p.storagename)
+	p.storeCurve(p.datastore, p.storagename)
+	if p.opts.AdaptiveQuantile > 0 {
+		p.datastore.Store(p.storagename+"-absslopes", p.absslopes.recent)
+	}
 	p.datastore.Store(p.storagename, p)
 }
 
-func (p *SigCurve) retrieveData(maxage time.Duration) (isvalid bool) {
+// / Everything but the samples (which may be shared - see MultiSigCurve) and the parameters
+func (p *SigCurve) storeCurve(fs store.Store, name string) {
+	fs.Store(name+"-variancecurve", p.variancecurve)
+	fs.Store(name+"-variancecurvedbg", p.variancecurvedbg)
+	fs.Store(name+"-rsqrd", p.rsqrd)
+}
+
+func (p *SigCurve) retrieveCurve(fs store.Store, name string, maxage time.Duration) (isvalid bool) {
 	floatdecoder := storables.StorableFloat(0)
-	timedecoder := storables.StorableTime{}
-	p.variance, isvalid = managedslice.NewManagedSliceFromStore(p.storagename+"-variance", p.datastore, floatdecoder, maxage)
-	if !isvalid {
-		return false
-	}
-	p.variancetime, isvalid = managedslice.NewManagedSliceFromStore(p.storagename+"-variancetime", p.datastore, timedecoder, maxage)
+	p.variancecurve, isvalid = managedslice.NewSliceFromStore[storables.StorableFloat](name+"-variancecurve", fs, floatdecoder, maxage)
 	if !isvalid {
 		return false
 	}
-	p.variancecurve, isvalid = managedslice.NewManagedSliceFromStore(p.storagename+"-variancecurve", p.datastore, floatdecoder, maxage)
+	p.variancecurvedbg, isvalid = managedslice.NewSliceFromStore[storables.StorableFloat](name+"-variancecurvedbg", fs, floatdecoder, maxage)
 	if !isvalid {
 		return false
 	}
-	p.variancecurvedbg, isvalid = managedslice.NewManagedSliceFromStore(p.storagename+"-variancecurvedbg", p.datastore, floatdecoder, maxage)
-	if !isvalid {
+	p.rsqrd, isvalid = managedslice.NewSliceFromStore[storables.StorableFloat](name+"-rsqrd", fs, floatdecoder, maxage)
+	isvalid = fs.Retrieve(name+"-rsqrd", maxage, p.rsqrd)
+	return isvalid
+}
+
+func (p *SigCurve) retrieveData(maxage time.Duration) (isvalid bool) {
+	if !p.samples.retrieve(p.datastore, p.storagename, maxage) {
 		return false
 	}
-	p.rsqrd, isvalid = managedslice.NewManagedSliceFromStore(p.storagename+"-rsqrd", p.datastore, floatdecoder, maxage)
-	isvalid = p.datastore.Retrieve(p.storagename+"-rsqrd", maxage, p.rsqrd)
-	if !isvalid {
+	if !p.retrieveCurve(p.datastore, p.storagename, maxage) {
 		return false
 	}
 	isvalid = p.datastore.Retrieve(p.storagename, maxage, p)
 	if !isvalid {
 		return false
 	}
+	if p.opts.AdaptiveQuantile > 0 {
+		/// if they weren't stored, start collecting them again - the min slope carries on from the stored value
+		absslopes, isvalid := managedslice.NewRingSliceFromStore[storables.StorableFloat](p.storagename+"-absslopes", p.datastore, storables.StorableFloat(0), maxage)
+		if isvalid {
+			p.absslopes.restore(absslopes)
+		}
+	}
 	return true
 }
 
@@ -214,26 +493,32 @@ func (p *SigCurve) SetupStorage(storename string, fs store.Store, howoftentosave
 // / potentially slightly wasteful in terms of memory - but it should get cleaned up
 func LoadFromStorage(storename string, fs store.Store, maxage time.Duration) (sigcurve *SigCurve, isvalid bool) {
 	sigcurve = &SigCurve{ /// create an empty one and try to load data into it
-		storagename:          storename,
-		datastore:            fs,
-		statsvariancebuysig:  perfstats.NewCounter("variance-buy-signalled"),
-		statsvariancesellsig: perfstats.NewCounter("variance-sell-signalled"),
-		wndcounter:           0,
-		//statslopedata:        perfstats.NewBucketCounter(-2, 2, 0.01, "slope-stats"),
-		statrsqrddata:  perfstats.NewBucketCounter(-1, 1, 0.05, "rsqrd-stats"),
-		statsvaliddata: perfstats.NewCounter("valid-data-sample"),
+		samples:     &sampleBuffer{},
+		storagename: storename,
+		datastore:   fs,
+		wndcounter:  0,
 	}
 	isvalid = sigcurve.retrieveData(maxage)
 	if !isvalid {
 		return nil, false /// let it know the load failed - it maybe considered an error condition
 	}
-	slopestatsrange := sigcurve.minslope * 2
-	slopestatsstep := sigcurve.minslope / 100
-	sigcurve.statslopedata = perfstats.NewBucketCounter(-1*slopestatsrange, slopestatsrange, slopestatsstep, "slope-stats")
+	sigcurve.setupStats("") /// after loading - the slope stats range comes from the min slope
 
 	return sigcurve, true
 }
 
+// / Set the clock used to throttle saves - e.g. a ManualClock when replaying historical data
+func (p *SigCurve) SetClock(clock Clock) {
+	p.clock = clock
+}
+
+func (p *SigCurve) now() time.Time {
+	if p.clock == nil {
+		return time.Now()
+	}
+	return p.clock.Now()
+}
+
 func (p *SigCurve) LogLevel(level int) {
 	p.loglevel = level
 }
@@ -246,15 +531,63 @@ func (p *SigCurve) logdbg(data ...interface{}) {
 	}
 }
 
+func (p *SigCurve) setupStats(prefix string) {
+	slopestatsrange := p.minslope * 2
+	slopestatsstep := p.minslope / 100
+	p.statsvariancebuysig = perfstats.NewCounter(prefix + "variance-buy-signalled")
+	p.statsvariancesellsig = perfstats.NewCounter(prefix + "variance-sell-signalled")
+	p.statslopedata = perfstats.NewBucketCounter(-1*slopestatsrange, slopestatsrange, slopestatsstep, prefix+"slope-stats")
+	p.statrsqrddata = perfstats.NewBucketCounter(-1, 1, 0.05, prefix+"rsqrd-stats")
+	p.statsvaliddata = perfstats.NewCounter(prefix + "valid-data-sample")
+	p.statsrejected = perfstats.NewCounter(prefix + "variance-sample-rejected")
+	p.stattstat = perfstats.NewBucketCounter(-10, 10, 0.5, prefix+"slope-tstat-stats")
+	p.statpvalue = perfstats.NewBucketCounter(0, 1, 0.05, prefix+"slope-pvalue-stats")
+	p.statsinsignificant = perfstats.NewCounter(prefix + "slope-insignificant")
+}
+
+// / Put prefix in front of all the stats counter names, e.g. to tell two SigCurves apart. The counts start again
+func (p *SigCurve) SetStatsPrefix(prefix string) {
+	p.setupStats(prefix)
+}
+
 func (p *SigCurve) GetStatsCounters() []perfstats.Stat {
-	return []perfstats.Stat{p.statsvariancebuysig, p.statsvariancesellsig, p.statrsqrddata, p.statslopedata, p.statsvaliddata}
+	return []perfstats.Stat{p.statsvariancebuysig, p.statsvariancesellsig, p.statrsqrddata, p.statslopedata, p.statsvaliddata,
+		p.statsrejected, p.stattstat, p.statpvalue, p.statsinsignificant}
+}
+
+// / How many NaN/Inf samples have been passed to AddVarianceSample, whatever the policy did with them
+func (p *SigCurve) RejectedSamples() int64 {
+	return p.rejected
+}
+
+// / Register a callback for whenever the direction changes - see eventSource for the caveats
+func (p *SigCurve) OnChange(callback func(SignalEvent)) {
+	p.events.onChange(callback)
+}
+
+// / A channel of direction changes. Sends don't block - if the buffer fills up, events are dropped
+func (p *SigCurve) Events(buffer int) <-chan SignalEvent {
+	return p.events.events(buffer)
+}
+
+// / Close all the channels returned by Events
+func (p *SigCurve) CloseEvents() {
+	p.events.closeEvents()
+}
+
+// / How many events have been dropped because a channel was full
+func (p *SigCurve) DroppedEvents() int64 {
+	return p.events.dropped
 }
 
 func (p *SigCurve) Plot() {
 	///for testing/trialling different values
-	fmt.Println("Raw data")
-	dataplot.PlotManagedSlice(p.variance, 80, 40)
+	p.samples.plot()
 	fmt.Println()
+	p.plotCurve()
+}
+
+func (p *SigCurve) plotCurve() {
 	fmt.Println("Curve data")
 	dataplot.PlotManagedSlice(p.variancecurvedbg, 80, 40)
 	/*for _, f := range p.variancecurvedbg.Items() {
@@ -264,42 +597,175 @@ func (p *SigCurve) Plot() {
 	dataplot.PlotManagedSlice(p.rsqrd, 80, 40)
 }
 
-func (p *SigCurve) linearRegressionFromArray(data []interface{}, sampletime []interface{}) (alpha, beta, rsqrd float64) {
+/*
+*
+The regression over the last window of samples, with time on the x axis (in units of the average time between samples)
+and the sample, normalised over the range of all the data, on the y axis.
+This uses the running sums kept by updateRegression, so there's no need to go through the window every time.
+*/
+func (p *SigCurve) linearRegressionFromSums() (alpha, beta, rsqrd float64) {
 	minprice, maxprice := p.getPriceRangeOverAllData()
-	///data is our x
-	// for now, the index of the data is y - so generate y
-	firstsampletime := time.Time(sampletime[0].(storables.StorableTime))
-	y := make([]float64, len(data))
-	x := make([]float64, len(data))
-	timerange := time.Time(sampletime[len(sampletime)-1].(storables.StorableTime)).Sub(firstsampletime)
-	avgtime := float64(timerange) / float64(len(sampletime))
-	for i, _ := range data {
-		x[i] = float64(time.Time(sampletime[i].(storables.StorableTime)).Sub(firstsampletime)) / avgtime
-		y[i] = (float64(data[i].(storables.StorableFloat)) - minprice) / (maxprice - minprice)
-	}
-	alpha, beta = stat.LinearRegression(x, y, nil, false)
-	rsqrd = stat.RSquared(x, y, nil, alpha, beta)
-	p.logdbg("regression ", beta, rsqrd)
+	alpha, beta, rsqrd = p.reg.regressionOver(p.samples.variancetime, minprice, maxprice)
+	if p.loglevel >= LOGDBG { /// check first, boxing the args for logdbg allocates
+		p.logdbg("regression ", beta, rsqrd)
+	}
 	p.statrsqrddata.Inc(rsqrd)
 	p.statslopedata.Inc(beta)
+	if len(p.lastfit.Coefficients) != 2 {
+		p.lastfit.Coefficients = make([]float64, 2)
+	}
+	p.lastfit.Coefficients[0] = alpha
+	p.lastfit.Coefficients[1] = beta
+	p.lastfit.RSquared = rsqrd
+	p.lastfit.Slope = beta
+	p.lastfit.Curvature = 0
+	p.lastfit.SlopeStdErr, p.lastfit.TStat, p.lastfit.PValue = slopeSignificance(beta, rsqrd, p.reg.n)
+	if !math.IsNaN(p.lastfit.TStat) {
+		p.stattstat.Inc(p.lastfit.TStat)
+		p.statpvalue.Inc(p.lastfit.PValue)
+	}
 	return alpha, beta, rsqrd
 }
 
+/*
+*
+The least squares polynomial fit of degree opts.Degree over the last window of samples, with the same x and y as
+linearRegressionFromSums. Slope is the gradient at the end of the window.
+*/
+func (p *SigCurve) polyFitFromWindow() PolyFit {
+	wnd := p.windowLen()
+	data := p.samples.variance.Items()[p.samples.variance.Len()-wnd:]
+	sampletime := p.samples.variancetime.Items()[p.samples.variancetime.Len()-wnd:]
+	minprice, maxprice := p.getPriceRangeOverAllData()
+	firstsampletime := time.Time(sampletime[0])
+	avgtime := float64(time.Time(sampletime[len(sampletime)-1]).Sub(firstsampletime)) / float64(wnd)
+	p.fitx = p.fitx[:0]
+	p.fity = p.fity[:0]
+	for i := range data {
+		p.fitx = append(p.fitx, float64(time.Time(sampletime[i]).Sub(firstsampletime))/avgtime)
+		p.fity = append(p.fity, (float64(data[i])-minprice)/(maxprice-minprice))
+	}
+	fit := fitPolynomial(p.fitx, p.fity, p.opts.Degree)
+	if p.loglevel >= LOGDBG {
+		p.logdbg("polynomial fit ", fit.Coefficients, fit.RSquared)
+	}
+	p.statrsqrddata.Inc(fit.RSquared)
+	p.statslopedata.Inc(fit.Slope)
+	p.lastfit = fit
+	return fit
+}
+
+/*
+*
+SigCurveSnapshot is the state of a SigCurve for logging and tuning.
+LastSlope is the last slope accepted into the curve and LastRSquared the R squared of the last fit, whether or not
+its slope was accepted - both are NaN until there is one.
+CurveLen and MinDataPoints are numbers of slopes - the signal is warmed up once CurveLen reaches MinDataPoints.
+Window and NumSamples are as configured, SampleCount is how many samples are currently held.
+*/
+type SigCurveSnapshot struct {
+	LastSlope     float64
+	LastRSquared  float64
+	LastPValue    float64 /// of the last fit's slope - NaN for polynomial fits
+	MinSlope      float64 /// the effective min slope - see EffectiveMinSlope
+	CurveLen      int
+	MinDataPoints int
+	WarmedUp      bool
+	Window        int
+	NumSamples    int
+	SampleCount   int
+	Direction     Direction
+	Rejected      int64
+}
+
+func (p *SigCurve) Snapshot() SigCurveSnapshot {
+	snap := SigCurveSnapshot{
+		LastSlope:     p.lastSlope(),
+		LastRSquared:  math.NaN(),
+		LastPValue:    math.NaN(),
+		MinSlope:      p.effectiveminslope,
+		CurveLen:      p.variancecurve.Len(),
+		MinDataPoints: p.mindatapoints,
+		WarmedUp:      p.variancecurve.Len() >= p.mindatapoints,
+		Window:        p.window,
+		NumSamples:    p.numorderbooksamples,
+		SampleCount:   p.samples.variance.Len(),
+		Direction:     DirectionOf(p),
+		Rejected:      p.rejected,
+	}
+	if p.lastfit.Coefficients != nil {
+		snap.LastRSquared = p.lastfit.RSquared
+		snap.LastPValue = p.lastfit.PValue
+	}
+	return snap
+}
+
+// / The last slope accepted into the curve - NaN if there isn't one yet
+func (p *SigCurve) lastSlope() float64 {
+	if p.variancecurve.Len() == 0 {
+		return math.NaN()
+	}
+	return float64(p.variancecurve.FromBack(0))
+}
+
+// / The last fit over the window - a straight line (alpha, beta) unless a higher Degree was configured
+func (p *SigCurve) LastFit() PolyFit {
+	return p.lastfit.copy()
+}
+
+// / Call after pushing a new sample - slides the regression window on by one
+func (p *SigCurve) updateRegression() {
+	if p.opts.WindowDuration > 0 {
+		p.reg.slideDuration(p.opts.WindowDuration, p.samples.variance, p.samples.variancetime)
+		return
+	}
+	p.reg.slide(p.window, p.samples.variance, p.samples.variancetime)
+}
+
+// / Whether the last fit's slope passes the SlopeConfidence test - always true if there isn't one
+func (p *SigCurve) significant() bool {
+	if p.opts.SlopeConfidence <= 0 {
+		return true
+	}
+	return p.lastfit.PValue < 1-p.opts.SlopeConfidence
+}
+
+// / How many samples are in the regression window
+func (p *SigCurve) windowLen() int {
+	if p.opts.WindowDuration > 0 {
+		return p.reg.n
+	}
+	if p.samples.variance.Len() < p.window {
+		return p.samples.variance.Len()
+	}
+	return p.window
+}
+
 func (p *SigCurve) trend() (isvalid, upwards bool) {
 	/// provided we have more than
-	p.logdbg("Variance curve len ", p.variancecurve.Len(), " min data points ", p.mindatapoints)
+	if p.loglevel >= LOGDBG {
+		p.logdbg("Variance curve len ", p.variancecurve.Len(), " min data points ", p.mindatapoints)
+	}
 	if p.variancecurve.Len() >= p.mindatapoints {
+		switch p.opts.Mode {
+		case TrendTurningPoint:
+			return p.turningPoint()
+		case TrendCurvature:
+			return p.curvature()
+		}
 
-		angle := float64(p.variancecurve.FromBack(0).(storables.StorableFloat))
+		angle := float64(p.variancecurve.FromBack(0))
 
 		//see if the last item is a non-shallow upward curve
-		p.logdbg("Curve angle is ", angle)
+		if p.loglevel >= LOGDBG {
+			p.logdbg("Curve angle is ", angle)
+		}
 		if angle > 0 {
-			if angle > p.minslope {
+			if angle > p.effectiveminslope {
 				return true, true
 			}
 		} else if angle < 0 {
-			if math.Abs(angle) > p.minslope {
+			if math.Abs(angle) > p.effectiveminslope {
 				return true, false
 			}
 		}
@@ -309,25 +775,95 @@ func (p *SigCurve) trend() (isvalid, upwards bool) {
 	return false, false
 }
 
-func (p *SigCurve) getPriceRangeOverAllData() (minprice, maxprice float64) {
-	min := p.variance.At(0).(storables.StorableFloat)
-	max := p.variance.At(0).(storables.StorableFloat)
-	for _, val := range p.variance.Items() {
-		if val.(storables.StorableFloat) < min {
-			min = val.(storables.StorableFloat)
+/*
+*
+Looks for the slope changing sign: the last TurnConfirm slopes all one sign, the TurnConfirm slopes before them all
+the other, and the steepest slope on each side at least TurnMinSlope.
+upwards means the curve has turned from falling to rising.
+*/
+func (p *SigCurve) turningPoint() (isvalid, upwards bool) {
+	confirm := p.opts.TurnConfirm
+	if p.variancecurve.Len() < 2*confirm {
+		return false, false
+	}
+	aftersign, aftersteepest := p.slopeRun(0, confirm)
+	beforesign, beforesteepest := p.slopeRun(confirm, confirm)
+	if aftersign == 0 || beforesign == 0 || aftersign == beforesign {
+		return false, false
+	}
+	if aftersteepest < p.opts.TurnMinSlope || beforesteepest < p.opts.TurnMinSlope {
+		return false, false
+	}
+	return true, aftersign > 0
+}
+
+// / If the n slopes starting from index from (counting back from the latest) are all the same sign, returns the sign
+// / and the steepest of them. Otherwise the sign is 0.
+func (p *SigCurve) slopeRun(from, n int) (sign int, steepest float64) {
+	for i := from; i < from+n; i++ {
+		slope := float64(p.variancecurve.FromBack(i))
+		s := 0
+		if slope > 0 {
+			s = 1
+		} else if slope < 0 {
+			s = -1
 		}
-		if val.(storables.StorableFloat) > max {
-			max = val.(storables.StorableFloat)
+		if s == 0 || (sign != 0 && s != sign) {
+			return 0, 0
 		}
+		sign = s
+		steepest = math.Max(steepest, math.Abs(slope))
 	}
-	return float64(min), float64(max)
+	return sign, steepest
 }
 
-func (p *SigCurve) AddVarianceSample(variance float64, t time.Time) {
+/*
+*
+Looks for a trend that's slowing down, from the latest fit: falling but curving upwards (e.g. a decline that's about to
+bottom out) signals buy, rising but curving downwards signals sell.
+*/
+func (p *SigCurve) curvature() (isvalid, upwards bool) {
+	fit := p.lastfit
+	if !(fit.RSquared > p.minrsqrd) {
+		return false, false
+	}
+	if fit.Slope < 0 && fit.Curvature >= p.opts.MinCurvature {
+		return true, true
+	}
+	if fit.Slope > 0 && fit.Curvature <= -p.opts.MinCurvature {
+		return true, false
+	}
+	return false, false
+}
+
+func (p *SigCurve) getPriceRangeOverAllData() (minprice, maxprice float64) {
+	return p.samples.priceRange()
+}
+
+/*
+*
+NaN/Inf samples are handled according to the BadSamplePolicy - an error is only returned for BadSampleError
+*/
+func (p *SigCurve) AddVarianceSample(variance float64, t time.Time) error {
 	//fmt.Println("Adding variance sample ", variance)
 	p.storeData() /// this should only store data after a given duration
-	p.variance.PushAndResize(storables.StorableFloat(variance * p.shiftfactor))
-	p.variancetime.PushAndResize(storables.StorableTime(t))
+	sample, bad, keep, err := p.samples.check(variance, variance*p.shiftfactor, t, p.opts.BadSamples)
+	if bad {
+		p.rejected++
+		p.statsrejected.Inc()
+	}
+	if !keep {
+		return err
+	}
+	p.samples.push(sample, t, p.numorderbooksamples, p.opts.HistoryDuration)
+	p.update(sample, t)
+	return nil
+}
+
+// / Call after sample has been pushed onto the samples - fits the window and updates the signals
+func (p *SigCurve) update(sample float64, t time.Time) {
+	newslope := false
+	p.updateRegression()
 	///Check the variance graph to see if we are on the way up
 	p.wndcounter++
 	if p.wndcounter > p.window {
@@ -335,15 +871,24 @@ func (p *SigCurve) AddVarianceSample(variance float64, t time.Time) {
 	}
 	///I need at least 2 windows to start
 	// thereafter, create a record every new window
-	if p.variance.Len() >= p.window { // calc it every time  && (p.wndcounter%p.window) == 0 {
+	if p.windowLen() >= p.window { // calc it every time  && (p.wndcounter%p.window) == 0 {
 		//p.logdbg("getting LR data")
-		_, grad, rsqrd := p.linearRegressionFromArray(p.variance.Items()[p.variance.Len()-(p.window):],
-			p.variancetime.Items()[p.variancetime.Len()-(p.window):])
+		var grad, rsqrd float64
+		if p.opts.Degree >= 2 {
+			fit := p.polyFitFromWindow()
+			grad, rsqrd = fit.Slope, fit.RSquared
+		} else {
+			_, grad, rsqrd = p.linearRegressionFromSums()
+		}
 		if !math.IsNaN(rsqrd) {
 			p.rsqrd.PushAndResize(storables.StorableFloat(rsqrd))
 		}
+		p.adaptMinSlope(grad)
 		/// don't push dubious results
-		if rsqrd > p.minrsqrd {
+		if rsqrd > p.minrsqrd && !p.significant() {
+			p.statsinsignificant.Inc()
+		} else if rsqrd > p.minrsqrd {
+			newslope = true
 			if math.IsNaN(grad) {
 				log.Panicln("Grad is NaN ", grad)
 			}
@@ -353,6 +898,18 @@ func (p *SigCurve) AddVarianceSample(variance float64, t time.Time) {
 		}
 		p.wndcounter = 0
 	} else {
+		/// with a duration window or history, there can be too few samples again after the window has been full -
+		/// nothing to signal on until it fills up again
+		p.wndcounter = 0
+		p.sigbuyonvariance = false
+		p.sigsellonvariance = false
+		p.events.update(SignalEvent{
+			Direction:  Neutral,
+			Time:       t,
+			Value:      sample,
+			Slope:      math.NaN(),
+			Percentile: math.NaN(),
+		})
 		return
 	}
 
@@ -361,8 +918,6 @@ func (p *SigCurve) AddVarianceSample(variance float64, t time.Time) {
 		p.logdbg("Data len less than min ", p.variancecurve.Len(), p.mindatapoints)
 		return
 	}
-	sigbuyonvariance := false
-	sigsellonvariance := false
 	///need a better algo here
 
 	///look for an inflection point
@@ -370,24 +925,47 @@ func (p *SigCurve) AddVarianceSample(variance float64, t time.Time) {
 	// beta < 0 => downward slope
 	// go backwards through the regression data to see if there's an inflection point
 	isvalid, upwards := p.trend()
+	if p.opts.Mode != TrendSlope && !newslope {
+		/// the fit didn't change the curve - nothing new to signal
+		isvalid = false
+	}
 
+	dir := Neutral
 	if isvalid {
 		p.statsvaliddata.Inc()
 		///if the 2nd direction is upwards then signal buy else sell
 		if upwards {
-			/// we have a turning point
-			//fmt.Println("Upturn curve detected ")
-			sigbuyonvariance = true
-			p.statsvariancebuysig.Inc()
+			dir = Buy
 		} else {
-			//fmt.Println("Downturn curve detected ")
-			/// we have a turning point
-			sigsellonvariance = true
-			p.statsvariancesellsig.Inc()
+			dir = Sell
 		}
 	}
-	p.sigbuyonvariance = sigbuyonvariance
-	p.sigsellonvariance = sigsellonvariance
+	if p.debounce != nil {
+		if p.opts.Mode == TrendSlope && p.opts.Debounce.hasBands() {
+			dir = p.debounce.Update(float64(p.variancecurve.FromBack(0)), t)
+		} else {
+			dir = p.debounce.UpdateDirection(dir, t)
+		}
+	}
+	switch dir {
+	case Buy:
+		/// we have a turning point
+		//fmt.Println("Upturn curve detected ")
+		p.statsvariancebuysig.Inc()
+	case Sell:
+		//fmt.Println("Downturn curve detected ")
+		/// we have a turning point
+		p.statsvariancesellsig.Inc()
+	}
+	p.sigbuyonvariance = dir == Buy
+	p.sigsellonvariance = dir == Sell
+	p.events.update(SignalEvent{
+		Direction:  dir,
+		Time:       t,
+		Value:      sample,
+		Slope:      float64(p.variancecurve.FromBack(0)),
+		Percentile: math.NaN(),
+	})
 }
 
 func (p *SigCurve) SigBuy() bool {
@@ -1,6 +1,8 @@
 package signals
 
 import (
+	"bytes"
+	"encoding/gob"
 	"fmt"
 	"github.com/paul-at-nangalan/short-term-store/store"
 	"gotest.tools/v3/assert"
@@ -160,3 +162,434 @@ func Test_StoreAndRetrieve(t *testing.T) {
 	assert.Equal(t, trend, false, "Mismatch - expected sig sell to be signalled after reload")
 	assert.Equal(t, isvalid, true, "Mismatch - expected sig to be valid after reload")
 }
+
+func TestSigCurve_BadSamples(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := SigCurveConfig{NumSamples: 1000, MinDataPoints: 900, MinSlope: 0.35, Window: 10, MinRSqrd: 0.45}
+	bad := []float64{math.NaN(), math.Inf(1), math.Inf(-1)}
+
+	drop, err := NewSigCurveFromConfig(cfg)
+	assert.NilError(t, err)
+	cfg.BadSamples = BadSampleCarryForward
+	carry, err := NewSigCurveFromConfig(cfg)
+	assert.NilError(t, err)
+	cfg.BadSamples = BadSampleError
+	witherr, err := NewSigCurveFromConfig(cfg)
+	assert.NilError(t, err)
+
+	for _, sig := range []*SigCurve{drop, carry, witherr} {
+		for _, val := range bad {
+			/// no earlier samples - nothing to carry forward either
+			sig.AddVarianceSample(val, start)
+		}
+		for i := 0; i < 20; i++ {
+			assert.NilError(t, sig.AddVarianceSample(float64(i), start.Add(time.Duration(i)*time.Second)))
+		}
+		for _, val := range bad {
+			err := sig.AddVarianceSample(val, start.Add(time.Minute))
+			if sig == witherr {
+				assert.ErrorIs(t, err, ErrBadSample)
+			} else {
+				assert.NilError(t, err)
+			}
+		}
+		assert.Equal(t, sig.RejectedSamples(), int64(6), "Mismatch rejected count")
+		for _, val := range sig.samples.variance.Items() {
+			if math.IsNaN(float64(val)) || math.IsInf(float64(val), 0) {
+				t.Fatal("Bad sample made it into the variance data")
+			}
+		}
+		for _, val := range sig.rsqrd.Items() {
+			if math.IsNaN(float64(val)) || math.IsInf(float64(val), 0) {
+				t.Fatal("Bad sample made it into the regression")
+			}
+		}
+	}
+	assert.Equal(t, drop.samples.variance.Len(), 20)
+	assert.Equal(t, witherr.samples.variance.Len(), 20)
+	assert.Equal(t, carry.samples.variance.Len(), 23)
+	assert.Equal(t, float64(carry.samples.variance.FromBack(0)), 19.0, "Expected the last good value to be carried forward")
+}
+
+func TestNewSigCurve_LegacyRange(t *testing.T) {
+	/// a negative min slope and min data points were always accepted by the original constructors
+	sig := NewSigCurveWithFactor(400, -10, -0.01, 10, 0.45, 0)
+	assert.Equal(t, sig.minslope, -0.01)
+	assert.Equal(t, sig.shiftfactor, 1.0)
+	_, err := NewSigCurveFromConfig(SigCurveConfig{NumSamples: 400, MinDataPoints: -10, MinSlope: -0.01, Window: 10})
+	assert.ErrorContains(t, err, "negative")
+}
+
+func TestSigCurve_OptionsStoreAndRetrieve(t *testing.T) {
+	sig, err := NewSigCurveFromConfig(SigCurveConfig{NumSamples: 1000, MinDataPoints: 900, MinSlope: 0.35, Window: 10,
+		MinRSqrd: 0.45, BadSamples: BadSampleCarryForward})
+	assert.NilError(t, err)
+	fs := newMemStore()
+	sig.SetupStorage("options-curve", fs, time.Hour)
+	sig.AddVarianceSample(1, time.Now())
+
+	loaded, isvalid := LoadFromStorage("options-curve", fs, time.Hour)
+	assert.Equal(t, isvalid, true)
+	assert.Equal(t, loaded.opts.BadSamples, BadSampleCarryForward, "Bad sample policy not restored")
+
+	/// data stored before there were any options should still load
+	old := &bytes.Buffer{}
+	enc := gob.NewEncoder(old)
+	for _, val := range []any{1000, 0.35, 10, 0, 91, 91, 0.45, 1.0, time.Hour} {
+		assert.NilError(t, enc.Encode(val))
+	}
+	decoded := &SigCurve{}
+	decoded.Decode(old)
+	assert.Equal(t, decoded.minslope, 0.35)
+	assert.Equal(t, decoded.saveduration, time.Hour)
+	assert.Equal(t, decoded.opts.BadSamples, BadSampleDrop)
+}
+
+// / V shaped data - down for half the samples and up for the rest, with a long run at the end
+func runVShape(sig *SigCurve, n int) (buys, sells []int) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		val := math.Abs(float64(i-n/3)) + 100
+		sig.AddVarianceSample(val, start.Add(time.Duration(i)*time.Second))
+		if sig.SigBuy() {
+			buys = append(buys, i)
+		}
+		if sig.SigSell() {
+			sells = append(sells, i)
+		}
+	}
+	return buys, sells
+}
+
+func TestSigCurve_TurningPoint(t *testing.T) {
+	cfg := SigCurveConfig{NumSamples: 400, MinDataPoints: 50, MinSlope: 0.001, Window: 10, MinRSqrd: 0.45}
+	slope, err := NewSigCurveFromConfig(cfg)
+	assert.NilError(t, err)
+	buys, _ := runVShape(slope, 600)
+	if len(buys) < 100 {
+		t.Error("Expected slope mode to signal buy all the way up the uptrend ", len(buys))
+	}
+
+	cfg.Mode = TrendTurningPoint
+	cfg.TurnConfirm = 3
+	cfg.TurnMinSlope = 0.001
+	turning, err := NewSigCurveFromConfig(cfg)
+	assert.NilError(t, err)
+	buys, sells := runVShape(turning, 600)
+	assert.Equal(t, len(sells), 0, "There's no downward turn")
+	assert.Equal(t, len(buys), 1, "Expected a single buy at the turn ", buys)
+	if buys[0] < 200 || buys[0] > 220 {
+		t.Error("Buy signalled too far from the bottom at 200 ", buys[0])
+	}
+
+	/// too steep a requirement - nothing should signal
+	cfg.TurnMinSlope = 1
+	steep, err := NewSigCurveFromConfig(cfg)
+	assert.NilError(t, err)
+	buys, _ = runVShape(steep, 600)
+	assert.Equal(t, len(buys), 0)
+
+	cfg.TurnConfirm = 100
+	_, err = NewSigCurveFromConfig(cfg)
+	assert.ErrorContains(t, err, "not enough to confirm")
+}
+
+// / A parabola with its turn at 300 - positive is a U, negative an upside down U
+func runParabola(sig *SigCurve, n int, sign float64) (buys, sells []int) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		x := float64(i-300) / 30
+		sig.AddVarianceSample(100+sign*x*x, start.Add(time.Duration(i)*time.Second))
+		if sig.SigBuy() {
+			buys = append(buys, i)
+		}
+		if sig.SigSell() {
+			sells = append(sells, i)
+		}
+	}
+	return buys, sells
+}
+
+func TestSigCurve_Curvature(t *testing.T) {
+	cfg := SigCurveConfig{NumSamples: 400, MinDataPoints: 50, MinSlope: 0.001, Window: 20, MinRSqrd: 0.45,
+		Mode: TrendCurvature, Degree: 2, MinCurvature: 1e-6}
+	sig, err := NewSigCurveFromConfig(cfg)
+	assert.NilError(t, err)
+	buys, sells := runParabola(sig, 600, 1)
+	assert.Equal(t, len(sells), 0, "Rising and speeding up shouldn't signal")
+	if len(buys) < 100 {
+		t.Error("Expected buys on the slowing decline ", len(buys))
+	}
+	for _, i := range buys {
+		if i > 300 {
+			t.Error("Buy signalled after the bottom ", i)
+			break
+		}
+	}
+	fit := sig.LastFit()
+	assert.Equal(t, len(fit.Coefficients), 3)
+	assertClose(t, fit.RSquared, 1, "exact parabola")
+	if !(fit.Curvature > 0) {
+		t.Error("Expected positive curvature ", fit.Curvature)
+	}
+
+	sig, err = NewSigCurveFromConfig(cfg)
+	assert.NilError(t, err)
+	buys, sells = runParabola(sig, 600, -1)
+	assert.Equal(t, len(buys), 0, "Falling and speeding up shouldn't signal")
+	if len(sells) < 100 {
+		t.Error("Expected sells on the slowing rise ", len(sells))
+	}
+
+	/// a straight line fit reports its alpha and beta
+	cfg.Mode = TrendSlope
+	cfg.Degree = 0
+	line, err := NewSigCurveFromConfig(cfg)
+	assert.NilError(t, err)
+	runParabola(line, 100, 1)
+	fit = line.LastFit()
+	assert.Equal(t, len(fit.Coefficients), 2)
+	assert.Equal(t, fit.Coefficients[1], fit.Slope)
+	assert.Equal(t, fit.Curvature, 0.0)
+
+	cfg.Mode = TrendCurvature
+	_, err = NewSigCurveFromConfig(cfg)
+	assert.ErrorContains(t, err, "degree of at least 2")
+	cfg.Degree = 20
+	_, err = NewSigCurveFromConfig(cfg)
+	assert.ErrorContains(t, err, "polynomial degree")
+}
+
+// / Counts how many times the direction changes while feeding a noisy sine wave
+func countFlips(sig *SigCurve, n int) (flips int) {
+	rnd := rand.New(rand.NewSource(3))
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	last := Neutral
+	for i := 0; i < n; i++ {
+		val := 10*math.Sin(float64(i)/40) + rnd.NormFloat64()
+		sig.AddVarianceSample(val, start.Add(time.Duration(i)*time.Second))
+		if dir := DirectionOf(sig); dir != last {
+			flips++
+			last = dir
+		}
+	}
+	return flips
+}
+
+func TestSigCurve_Debounce(t *testing.T) {
+	cfg := SigCurveConfig{NumSamples: 400, MinDataPoints: 50, MinSlope: 0.01, Window: 20, MinRSqrd: 0.3}
+	raw, err := NewSigCurveFromConfig(cfg)
+	assert.NilError(t, err)
+	rawflips := countFlips(raw, 2000)
+
+	cfg.Debounce = &DebounceConfig{
+		Buy:      Band{Enter: 0.01, Exit: 0.005},
+		Sell:     Band{Enter: -0.01, Exit: -0.005, Below: true},
+		Confirm:  3,
+		Cooldown: 10 * time.Second,
+	}
+	debounced, err := NewSigCurveFromConfig(cfg)
+	assert.NilError(t, err)
+	flips := countFlips(debounced, 2000)
+	if flips == 0 || flips*2 > rawflips {
+		t.Error("Expected debouncing to at least halve the chatter ", rawflips, flips)
+	}
+
+	/// only a buy band - it should never sell
+	cfg.Debounce = &DebounceConfig{Buy: Band{Enter: 0.01, Exit: 0.005}}
+	buyonly, err := NewSigCurveFromConfig(cfg)
+	assert.NilError(t, err)
+	rnd := rand.New(rand.NewSource(3))
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	buys := 0
+	for i := 0; i < 2000; i++ {
+		buyonly.AddVarianceSample(10*math.Sin(float64(i)/40)+rnd.NormFloat64(), start.Add(time.Duration(i)*time.Second))
+		if buyonly.SigSell() {
+			t.Fatal("Sell signalled without a sell band at ", i)
+		}
+		if buyonly.SigBuy() {
+			buys++
+		}
+	}
+	assert.Assert(t, buys > 0, "Expected the buy band to still signal")
+
+	cfg.Debounce.Confirm = -1
+	_, err = NewSigCurveFromConfig(cfg)
+	assert.ErrorContains(t, err, "can't be negative")
+
+	/// a turning point would never be confirmed
+	cfg.Mode = TrendTurningPoint
+	cfg.TurnConfirm = 2
+	cfg.Debounce = &DebounceConfig{Confirm: 2}
+	_, err = NewSigCurveFromConfig(cfg)
+	assert.ErrorContains(t, err, "only the debounce cooldown")
+	cfg.Debounce = &DebounceConfig{Buy: Band{Enter: 0.01, Exit: 0.005}}
+	_, err = NewSigCurveFromConfig(cfg)
+	assert.ErrorContains(t, err, "only the debounce cooldown")
+	cfg.Debounce = &DebounceConfig{Confirm: 1, Cooldown: time.Minute}
+	_, err = NewSigCurveFromConfig(cfg)
+	assert.NilError(t, err)
+}
+
+func TestSigCurve_Snapshot(t *testing.T) {
+	sig := NewSigCurve(400, 50, 0.001, 10, 0.45)
+	snap := sig.Snapshot()
+	assert.Assert(t, math.IsNaN(snap.LastSlope) && math.IsNaN(snap.LastRSquared), "Nothing fitted yet")
+	assert.Equal(t, snap.WarmedUp, false)
+	assert.Equal(t, snap.MinDataPoints, 6)
+	assert.Equal(t, snap.Window, 10)
+	assert.Equal(t, snap.NumSamples, 400)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 12; i++ {
+		sig.AddVarianceSample(float64(i), start.Add(time.Duration(i)*time.Second))
+	}
+	snap = sig.Snapshot()
+	assert.Equal(t, snap.SampleCount, 12)
+	assert.Equal(t, snap.CurveLen, 3)
+	assert.Equal(t, snap.WarmedUp, false)
+	assertClose(t, snap.LastRSquared, 1, "straight line")
+	assert.Assert(t, snap.LastSlope > 0)
+
+	runVShape(sig, 600)
+	snap = sig.Snapshot()
+	assert.Equal(t, snap.SampleCount, 400)
+	assert.Equal(t, snap.WarmedUp, true)
+	assert.Equal(t, snap.Direction, Buy)
+	assert.Equal(t, snap.LastSlope, float64(sig.variancecurve.FromBack(0)))
+}
+
+func TestSigCurve_DurationWindow(t *testing.T) {
+	cfg := SigCurveConfig{NumSamples: 1000, MinDataPoints: 50, MinSlope: 0.001, Window: 5, MinRSqrd: 0.45,
+		WindowDuration: 20 * time.Second, HistoryDuration: 5 * time.Minute}
+	sig, err := NewSigCurveFromConfig(cfg)
+	assert.NilError(t, err)
+	rnd := rand.New(rand.NewSource(5))
+	sampletime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	/// irregular ticks, down for 10 minutes then up
+	var signals []Direction
+	for sampletime.Before(time.Date(2024, 1, 1, 0, 20, 0, 0, time.UTC)) {
+		sampletime = sampletime.Add(time.Duration(100+rnd.Intn(2000)) * time.Millisecond)
+		secs := sampletime.Sub(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)).Seconds()
+		assert.NilError(t, sig.AddVarianceSample(math.Abs(secs-600)+100, sampletime))
+		signals = append(signals, DirectionOf(sig))
+		assert.Assert(t, sampletime.Sub(time.Time(sig.samples.variancetime.At(0))) < 5*time.Minute, "Expected the history to be trimmed")
+	}
+	assert.Equal(t, signals[len(signals)/4], Sell)
+	assert.Equal(t, signals[len(signals)-1], Buy)
+
+	/// a gap longer than the window - not enough samples in it for a regression, so nothing to signal on
+	var events []SignalEvent
+	sig.OnChange(func(event SignalEvent) {
+		events = append(events, event)
+	})
+	sampletime = sampletime.Add(time.Minute)
+	sig.AddVarianceSample(1000, sampletime)
+	assert.Equal(t, sig.windowLen(), 1)
+	assert.Equal(t, DirectionOf(sig), Neutral, "Expected the buy to be dropped once the window runs short")
+	assert.Equal(t, len(events), 1)
+	assert.Equal(t, events[0].Direction, Neutral)
+	assert.Equal(t, sig.Snapshot().SampleCount > 1, true, "The history is longer than the gap")
+
+	fs := newMemStore()
+	sig.SetupStorage("duration-curve", fs, time.Hour)
+	sig.AddVarianceSample(1000, sampletime.Add(time.Second))
+	loaded, isvalid := LoadFromStorage("duration-curve", fs, time.Hour)
+	assert.Equal(t, isvalid, true)
+	assert.Equal(t, loaded.opts.WindowDuration, cfg.WindowDuration)
+	assert.Equal(t, loaded.opts.HistoryDuration, cfg.HistoryDuration)
+
+	cfg.HistoryDuration = time.Second
+	_, err = NewSigCurveFromConfig(cfg)
+	assert.ErrorContains(t, err, "at least the window duration")
+	cfg.WindowDuration = -time.Second
+	_, err = NewSigCurveFromConfig(cfg)
+	assert.ErrorContains(t, err, "can't be negative")
+}
+
+func TestSigCurve_SlopeConfidence(t *testing.T) {
+	feed := func(sig *SigCurve, trend float64) {
+		rnd := rand.New(rand.NewSource(17))
+		start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		for i := 0; i < 1000; i++ {
+			sig.AddVarianceSample(100+trend*float64(i)+rnd.NormFloat64(), start.Add(time.Duration(i)*time.Second))
+		}
+	}
+	cfg := SigCurveConfig{NumSamples: 400, MinDataPoints: 50, MinSlope: 0.001, Window: 20, MinRSqrd: 0}
+	noisy, err := NewSigCurveFromConfig(cfg)
+	assert.NilError(t, err)
+	feed(noisy, 0)
+	assert.Equal(t, noisy.variancecurvedbg.Len(), 400, "Every slope gets in with no R squared limit")
+
+	cfg.SlopeConfidence = 0.99
+	significant, err := NewSigCurveFromConfig(cfg)
+	assert.NilError(t, err)
+	feed(significant, 0)
+	if significant.variancecurvedbg.Len() > 40 {
+		t.Error("Expected most slopes of noise to be rejected ", significant.variancecurvedbg.Len())
+	}
+	fit := significant.LastFit()
+	assert.Assert(t, fit.PValue >= 0 && fit.PValue <= 1, fit.PValue)
+	assert.Assert(t, !math.IsNaN(fit.TStat) && !math.IsNaN(fit.SlopeStdErr))
+
+	trending, err := NewSigCurveFromConfig(cfg)
+	assert.NilError(t, err)
+	feed(trending, 0.5)
+	assert.Equal(t, trending.variancecurvedbg.Len(), 400, "A clear trend is always significant")
+	assert.Equal(t, DirectionOf(trending), Buy)
+
+	cfg.SlopeConfidence = 1
+	_, err = NewSigCurveFromConfig(cfg)
+	assert.ErrorContains(t, err, "slope confidence")
+	cfg.SlopeConfidence = 0.9
+	cfg.Degree = 2
+	_, err = NewSigCurveFromConfig(cfg)
+	assert.ErrorContains(t, err, "only for straight line fits")
+}
+
+func TestSigCurve_AdaptiveMinSlope(t *testing.T) {
+	feed := func(sig *SigCurve, from, to int) (signalled int) {
+		rnd := rand.New(rand.NewSource(int64(from)))
+		start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		for i := from; i < to; i++ {
+			sig.AddVarianceSample(100+rnd.NormFloat64(), start.Add(time.Duration(i)*time.Second))
+			if DirectionOf(sig) != Neutral {
+				signalled++
+			}
+		}
+		return signalled
+	}
+	cfg := SigCurveConfig{NumSamples: 400, MinDataPoints: 50, MinSlope: 0.0001, Window: 20, MinRSqrd: 0}
+	fixed, err := NewSigCurveFromConfig(cfg)
+	assert.NilError(t, err)
+	feed(fixed, 0, 1000)
+	fixedsignals := feed(fixed, 1000, 3000)
+	assert.Equal(t, fixed.EffectiveMinSlope(), 0.0001)
+
+	cfg.AdaptiveQuantile = 0.95
+	cfg.AdaptiveSamples = 500
+	adaptive, err := NewSigCurveFromConfig(cfg)
+	assert.NilError(t, err)
+	fs := newMemStore()
+	adaptive.SetupStorage("adaptive-curve", fs, time.Hour)
+	feed(adaptive, 0, 1000) /// until there are AdaptiveSamples slopes, it uses MinSlope
+	adaptivesignals := feed(adaptive, 1000, 3000)
+	if adaptivesignals*3 > fixedsignals {
+		t.Error("Expected the adaptive min slope to cut the signals on noise ", fixedsignals, adaptivesignals)
+	}
+	assert.Assert(t, adaptive.EffectiveMinSlope() > 0.0001)
+	assertClose(t, adaptive.EffectiveMinSlope(), adaptive.absslopes.quantile(0.95), "effective min slope")
+	assert.Equal(t, adaptive.Snapshot().MinSlope, adaptive.EffectiveMinSlope())
+
+	/// force a save of the current state
+	adaptive.lastsaved = time.Time{}
+	adaptive.storeData()
+	loaded, isvalid := LoadFromStorage("adaptive-curve", fs, time.Hour)
+	assert.Equal(t, isvalid, true)
+	assert.Equal(t, loaded.EffectiveMinSlope(), adaptive.EffectiveMinSlope())
+	assert.DeepEqual(t, loaded.absslopes.sorted, adaptive.absslopes.sorted)
+
+	cfg.AdaptiveSamples = 0
+	_, err = NewSigCurveFromConfig(cfg)
+	assert.ErrorContains(t, err, "positive number of samples")
+}
@@ -0,0 +1,67 @@
+package signals
+
+import (
+	"github.com/paul-at-nangalan/short-term-store/store"
+	perfstats "github.com/paul-at-nangalan/stats/stats"
+	"time"
+)
+
+type Direction int
+
+const (
+	Neutral Direction = iota
+	Buy
+	Sell
+)
+
+func (d Direction) String() string {
+	switch d {
+	case Buy:
+		return "buy"
+	case Sell:
+		return "sell"
+	}
+	return "neutral"
+}
+
+/*
+*
+Signal is the common set of methods shared by all the signal generators, so they can be kept in slices/maps
+and handled generically. Feeding data in is specific to each signal (AddVarianceSample, AddData etc), so it's not
+part of the interface.
+*/
+type Signal interface {
+	SigBuy() bool
+	SigSell() bool
+	GetStatsCounters() []perfstats.Stat
+	Plot()
+	SetupStorage(storename string, fs store.Store, howoftentosave time.Duration)
+}
+
+// / Implemented by the signals whose stats counter names can be prefixed - e.g. so the combinator can tell its children apart
+type StatsPrefixer interface {
+	SetStatsPrefix(prefix string)
+}
+
+var (
+	_ Signal = &SigCurve{}
+	_ Signal = &SigPercentile{}
+	_ Signal = &MultiSigCurve{}
+
+	_ StatsPrefixer = &SigCurve{}
+	_ StatsPrefixer = &SigPercentile{}
+	_ StatsPrefixer = &MultiSigCurve{}
+)
+
+// / If a signal somehow signals both buy and sell, treat it as neutral - there's no clear direction
+func DirectionOf(sig Signal) Direction {
+	buy := sig.SigBuy()
+	sell := sig.SigSell()
+	if buy && !sell {
+		return Buy
+	}
+	if sell && !buy {
+		return Sell
+	}
+	return Neutral
+}
@@ -0,0 +1,30 @@
+package signals
+
+import (
+	"gotest.tools/v3/assert"
+	"testing"
+	"time"
+)
+
+func TestDirectionOf(t *testing.T) {
+	sigs := []Signal{
+		NewSigCurve(1000, 900, 0.35, 10, 0.45),
+		NewSigPercentile(0.25, 0.75, 1000, time.Second),
+	}
+	for _, sig := range sigs {
+		assert.Equal(t, DirectionOf(sig), Neutral, "Expected a new signal to be neutral")
+	}
+
+	sig := sigs[1].(*SigPercentile)
+	sig.sigbuy = true
+	assert.Equal(t, DirectionOf(sig), Buy, "Mismatch direction on buy")
+	sig.sigbuy = false
+	sig.sigsell = true
+	assert.Equal(t, DirectionOf(sig), Sell, "Mismatch direction on sell")
+	sig.sigbuy = true
+	assert.Equal(t, DirectionOf(sig), Neutral, "Conflicting signals should be neutral")
+
+	assert.Equal(t, Buy.String(), "buy")
+	assert.Equal(t, Sell.String(), "sell")
+	assert.Equal(t, Neutral.String(), "neutral")
+}
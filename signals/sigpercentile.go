@@ -14,27 +14,33 @@ import (
 	"io"
 	"log"
 	"math"
+	"sort"
 	"time"
 )
 
 const (
-	FP_TOLERANCE = 0.0000000000001
+	FP_TOLERANCE     = 0.0000000000001
+	MAX_DECAY_GROWTH = 64 /// half lives before the decayed weights are scaled back down
 )
 
 type Bin struct {
 	lowerval   float64
 	upperval   float64
-	count      float64
+	count      float64 /// with a half life, this is a weight relative to the decay reference time, not a count
 	lastupdate time.Time
 }
 
 func NewBin(start, interval, offest float64) *Bin {
+	return newBinAt(start, interval, offest, time.Now())
+}
+
+func newBinAt(start, interval, offest float64, t time.Time) *Bin {
 	//fmt.Println("Create new bin at ", start, " with interval ", interval, " and offset ", offest)
 	return &Bin{
 		lowerval:   start + (interval * offest),
 		upperval:   start + (interval * offest) + interval,
 		count:      0,
-		lastupdate: time.Now(),
+		lastupdate: t,
 	}
 }
 
@@ -65,16 +71,32 @@ func (p *Bin) MidValue() float64 {
 }
 
 func (p *Bin) Add(val float64) {
+	p.addAt(val, time.Now())
+}
+
+func (p *Bin) addAt(val float64, t time.Time) {
+	p.addWeightAt(val, 1, t)
+}
+
+func (p *Bin) addWeightAt(val, weight float64, t time.Time) {
 	if val > (p.upperval+FP_TOLERANCE) || val < (p.lowerval-FP_TOLERANCE) {
 		log.Panic("Adding val to bin outside range ", val, p)
 	}
-	p.lastupdate = time.Now()
-	p.count++
+	p.lastupdate = t
+	p.count += weight
 }
 
 func (p *Bin) TryAdd(val float64) bool {
+	return p.tryAddAt(val, time.Now())
+}
+
+func (p *Bin) tryAddAt(val float64, t time.Time) bool {
+	return p.tryAddWeightAt(val, 1, t)
+}
+
+func (p *Bin) tryAddWeightAt(val, weight float64, t time.Time) bool {
 	if val >= (p.lowerval-FP_TOLERANCE) && val <= (p.upperval+FP_TOLERANCE) {
-		p.Add(val)
+		p.addWeightAt(val, weight, t)
 		return true
 	}
 	return false
@@ -83,7 +105,22 @@ func (p *Bin) Count() float64 {
 	return p.count
 }
 func (p *Bin) LastUpdate() time.Duration {
-	return time.Now().Sub(p.lastupdate)
+	return p.age(time.Now())
+}
+
+func (p *Bin) age(now time.Time) time.Duration {
+	return now.Sub(p.lastupdate)
+}
+
+// / Options added after the original set of parameters - see curveOptions
+type percentileOptions struct {
+	Debounce    *DebounceConfig
+	Backend     DistributionBackend
+	Compression float64
+	HalfLife    time.Duration
+
+	ExactWindow         int
+	ExactWindowDuration time.Duration
 }
 
 type SigPercentile struct {
@@ -96,14 +133,22 @@ type SigPercentile struct {
 	bins                   []*Bin
 	targetnumbins          int
 	pruneabove             int
-	lastdata               *managedslice.Slice
-	lastpercentile         *managedslice.Slice //// THIS IS FOR STATS PURPOSES (not stored)
+	lastdata               *managedslice.Slice[storables.StorableFloat] /// with an exact window, this is the window
+	lasttimes              *managedslice.Slice[storables.StorableTime]  /// exact window duration only
+	lastpercentile         *managedslice.Slice[storables.StorableFloat] //// THIS IS FOR STATS PURPOSES (not stored)
 	percentiles            *perfstats.BucketCounter
 	targetage              time.Duration
 
 	sigbuy  bool
 	sigsell bool
 
+	clock    Clock
+	opts     percentileOptions
+	debounce *Debouncer
+	events   eventSource
+	dist     Distribution /// nil when using the bins
+	decayref time.Time    /// with a half life, bin weights are relative to this
+
 	datastore    store.Store
 	storagename  string
 	saveduration time.Duration
@@ -115,43 +160,190 @@ type SigPercentile struct {
 targetage - the ideal age of data to calculate the percentile from - e.g. if you want to use ~1 days worth of data ideally, then set 1d
 */
 func NewSigPercentile(buybelow, sellabove float64, mindata int, targetage time.Duration) *SigPercentile {
+	/// only the original check - NewSigPercentileFromConfig is stricter
 	if targetage == 0 {
 		log.Panic("Target age is zero")
 	}
+	return newSigPercentile(SigPercentileConfig{
+		BuyBelow:  buybelow,
+		SellAbove: sellabove,
+		MinData:   mindata,
+		TargetAge: targetage,
+	})
+}
+
+// / Same parameters as NewSigPercentile
+type SigPercentileConfig struct {
+	BuyBelow  float64
+	SellAbove float64
+	MinData   int
+	TargetAge time.Duration
+	Clock     Clock /// defaults to WallClock
+
+	/// Optional - stops the signals chattering. The bands (if set) are applied to the percentile, e.g.
+	/// Buy: Band{Enter: 0.25, Exit: 0.3, Below: true}, otherwise it just confirms and cools down the raw signal
+	Debounce *DebounceConfig
+
+	/// Optional - where the percentiles come from. BackendBins (the default) is the original bins, BackendTDigest keeps
+	/// a t-digest instead, which uses bounded memory and is more accurate in the tails
+	Backend     DistributionBackend
+	Compression float64 /// t-digest only - more is more accurate but uses more memory, defaults to 100
+
+	/// Optional - instead of a Backend, any (empty) Distribution. It's stored with the rest of the data, but it can't
+	/// be created from what's stored, so load it with LoadFromStorageSigPCWith and another empty one of the same kind
+	Distribution Distribution
+
+	/// Optional - bins only. Every sample's weight halves every HalfLife, so the percentiles come from roughly the
+	/// last few half lives of data rather than everything the interior bins have ever seen
+	HalfLife time.Duration
+
+	/// Optional - bins only. The percentiles come from exactly the last ExactWindow samples - as each one leaves the
+	/// window it's taken back out of its bin, and only empty bins are pruned. Set ExactWindowDuration as well to also
+	/// drop samples older than that (ExactWindow is then the most it will hold)
+	ExactWindow         int
+	ExactWindowDuration time.Duration
+}
+
+func (c SigPercentileConfig) Validate() error {
+	if c.TargetAge <= 0 {
+		return fmt.Errorf("target age must be positive, got %v", c.TargetAge)
+	}
+	if c.MinData <= 0 {
+		return fmt.Errorf("min data must be positive, got %d", c.MinData)
+	}
+	if c.BuyBelow < 0 || c.BuyBelow > 1 || c.SellAbove < 0 || c.SellAbove > 1 {
+		return fmt.Errorf("buy below and sell above are percentiles and must be between 0 and 1, got %v and %v",
+			c.BuyBelow, c.SellAbove)
+	}
+	if c.Debounce != nil {
+		if err := c.Debounce.Validate(); err != nil {
+			return err
+		}
+	}
+	if err := c.Backend.validate(); err != nil {
+		return err
+	}
+	if c.Backend == BackendCustom && c.Distribution == nil {
+		return fmt.Errorf("the custom backend needs a distribution")
+	}
+	if c.Distribution != nil && c.Backend != BackendBins && c.Backend != BackendCustom {
+		return fmt.Errorf("set either a backend or a distribution, not both")
+	}
+	if c.Compression < 0 {
+		return fmt.Errorf("compression must not be negative, got %v", c.Compression)
+	}
+	if c.HalfLife < 0 {
+		return fmt.Errorf("half life must not be negative, got %v", c.HalfLife)
+	}
+	if c.HalfLife > 0 && !c.usesBins() {
+		return fmt.Errorf("half life is only supported with the bins backend")
+	}
+	if c.ExactWindow < 0 || c.ExactWindowDuration < 0 {
+		return fmt.Errorf("exact window must not be negative, got %d and %v", c.ExactWindow, c.ExactWindowDuration)
+	}
+	if c.ExactWindowDuration > 0 && c.ExactWindow == 0 {
+		return fmt.Errorf("exact window duration needs an exact window size to bound it")
+	}
+	if c.ExactWindow > 0 {
+		if c.ExactWindow < c.MinData {
+			return fmt.Errorf("exact window %d must be at least min data %d", c.ExactWindow, c.MinData)
+		}
+		if c.HalfLife > 0 {
+			return fmt.Errorf("exact window and half life can't be used together")
+		}
+		if !c.usesBins() {
+			return fmt.Errorf("exact window is only supported with the bins backend")
+		}
+	}
+	return nil
+}
+
+func (c SigPercentileConfig) usesBins() bool {
+	return c.Backend == BackendBins && c.Distribution == nil
+}
+
+func NewSigPercentileFromConfig(cfg SigPercentileConfig) (*SigPercentile, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return newSigPercentile(cfg), nil
+}
+
+// / cfg isn't validated - see NewSigPercentile
+func newSigPercentile(cfg SigPercentileConfig) *SigPercentile {
+	if cfg.Distribution != nil {
+		cfg.Backend = BackendCustom
+	}
 	//// Don't create any bins until we have an idea of the range
-	return &SigPercentile{
-		buybelow:      buybelow,
-		sellabove:     sellabove,
+	sig := &SigPercentile{
+		buybelow:      cfg.BuyBelow,
+		sellabove:     cfg.SellAbove,
 		bins:          make([]*Bin, 0),
-		mindata:       mindata,
+		mindata:       cfg.MinData,
 		targetnumbins: 1000,
 		pruneabove:    2000,
 
-		lastdata:       managedslice.NewManagedSlice(0, 2*mindata),
-		lastpercentile: managedslice.NewManagedSlice(0, 2*mindata),
-		percentiles:    perfstats.NewBucketCounter(0, 1, 0.05, "percentiles"),
-		targetage:      targetage,
-	}
+		lastdata:       managedslice.NewSlice[storables.StorableFloat](0, 2*cfg.MinData),
+		lastpercentile: managedslice.NewSlice[storables.StorableFloat](0, 2*cfg.MinData),
+		targetage:      cfg.TargetAge,
+		clock:          cfg.Clock,
+		opts: percentileOptions{
+			Debounce:    cfg.Debounce,
+			Backend:     cfg.Backend,
+			Compression: cfg.Compression,
+			HalfLife:    cfg.HalfLife,
+
+			ExactWindow:         cfg.ExactWindow,
+			ExactWindowDuration: cfg.ExactWindowDuration,
+		},
+	}
+	if cfg.ExactWindow > 0 {
+		sig.lastdata = managedslice.NewSlice[storables.StorableFloat](0, cfg.ExactWindow)
+	}
+	if cfg.ExactWindowDuration > 0 {
+		sig.lasttimes = managedslice.NewSlice[storables.StorableTime](0, cfg.ExactWindow)
+	}
+	sig.setupStats("")
+	sig.setupDebounce()
+	sig.dist = cfg.Distribution
+	if sig.dist == nil {
+		sig.dist = newDistribution(cfg.Backend, cfg.Compression, cfg.TargetAge)
+	}
+	return sig
 }
 
 // /Optionally, try to load data from a store - make sure the name is unique
 // / potentially slightly wasteful in terms of memory - but it should get cleaned up
 func LoadFromStorageSigPC(storename string, fs store.Store, maxage time.Duration) (sigpc *SigPercentile, isvalid bool) {
+	return LoadFromStorageSigPCWith(storename, fs, maxage, nil)
+}
+
+// / For a SigPercentile set up with a Distribution in its config - dist is an empty one of the same kind to load it into
+func LoadFromStorageSigPCWith(storename string, fs store.Store, maxage time.Duration, dist Distribution) (sigpc *SigPercentile, isvalid bool) {
 	sigpc = &SigPercentile{ /// create an empty one and try to load data into it
 		storagename: storename,
 		datastore:   fs,
-		percentiles: perfstats.NewBucketCounter(0, 1, 0.05, "percentiles"),
 	}
-	isvalid = sigpc.retrieveData(maxage)
+	sigpc.setupStats("")
+	isvalid = sigpc.retrieveData(maxage, dist)
 	if !isvalid {
 		return nil, false /// let it know the load failed - it maybe considered an error condition
 	}
 
-	sigpc.lastpercentile = managedslice.NewManagedSlice(0, 2*sigpc.mindata)
+	sigpc.lastpercentile = managedslice.NewSlice[storables.StorableFloat](0, 2*sigpc.mindata)
 
 	return sigpc, true
 }
 
+func (p *SigPercentile) setupStats(prefix string) {
+	p.percentiles = perfstats.NewBucketCounter(0, 1, 0.05, prefix+"percentiles")
+}
+
+// / Put prefix in front of all the stats counter names, e.g. to tell two SigPercentiles apart. The counts start again
+func (p *SigPercentile) SetStatsPrefix(prefix string) {
+	p.setupStats(prefix)
+}
+
 func (p *SigPercentile) GetStatsCounters() []perfstats.Stat {
 	return []perfstats.Stat{p.percentiles}
 }
@@ -189,6 +381,10 @@ func (p *SigPercentile) Encode(buffer io.Writer) {
 	for _, bin := range p.bins {
 		bin.encode(enc)
 	}
+	err = enc.Encode(p.opts)
+	handlers.PanicOnError(err)
+	err = enc.Encode(p.decayref)
+	handlers.PanicOnError(err)
 
 	buffer.Write(params.Bytes())
 }
@@ -227,26 +423,85 @@ func (p *SigPercentile) Decode(buffer io.Reader) {
 		p.bins[i] = &Bin{}
 		p.bins[i].decode(enc)
 	}
+	err = enc.Decode(&p.opts)
+	if err != io.EOF { /// stored before there were any options
+		handlers.PanicOnError(err)
+	}
+	err = enc.Decode(&p.decayref)
+	if err != io.EOF {
+		handlers.PanicOnError(err)
+	}
+	p.setupDebounce()
 }
 
-func (p *SigPercentile) storeData() {
-	if p.datastore == nil || p.lastsaved.Add(p.saveduration).After(time.Now()) {
+// / The debouncer's state isn't stored - after a restart it has to confirm the signal again
+func (p *SigPercentile) setupDebounce() {
+	p.debounce = nil
+	if p.opts.Debounce != nil {
+		p.debounce = &Debouncer{cfg: *p.opts.Debounce}
+	}
+}
+
+func (p *SigPercentile) storeData(now time.Time) {
+	if p.datastore == nil || p.lastsaved.Add(p.saveduration).After(now) {
 		return
 	}
-	p.lastsaved = time.Now()
+	p.lastsaved = now
 	p.datastore.Store(p.storagename+"-lastdata", p.lastdata)
+	if p.lasttimes != nil {
+		p.datastore.Store(p.storagename+"-lasttimes", p.lasttimes)
+	}
+	if p.dist != nil {
+		p.datastore.Store(p.storagename+"-dist", p.dist)
+	}
 
 	p.datastore.Store(p.storagename, p)
 }
 
-func (p *SigPercentile) retrieveData(maxage time.Duration) (isvalid bool) {
+func (p *SigPercentile) retrieveData(maxage time.Duration, dist Distribution) (isvalid bool) {
 	floatdecoder := storables.StorableFloat(0)
 	//timedecoder := StorableTime{}
-	p.lastdata, isvalid = managedslice.NewManagedSliceFromStore(p.storagename+"-lastdata", p.datastore, floatdecoder, maxage)
+	p.lastdata, isvalid = managedslice.NewSliceFromStore[storables.StorableFloat](p.storagename+"-lastdata", p.datastore, floatdecoder, maxage)
 	if !isvalid {
 		return false
 	}
 	p.datastore.Retrieve(p.storagename, maxage, p)
+	if p.opts.ExactWindowDuration > 0 {
+		/// the window can't be expired without the times
+		p.lasttimes, isvalid = managedslice.NewSliceFromStore[storables.StorableTime](p.storagename+"-lasttimes",
+			p.datastore, storables.StorableTime{}, maxage)
+		if !isvalid {
+			return false
+		}
+		if p.lasttimes.Len() != p.lastdata.Len() {
+			/// stored at different times - each sample in the window needs its time to expire it
+			log.Println("Stored window and window times don't match ", p.lastdata.Len(), p.lasttimes.Len())
+			return false
+		}
+	}
+	if p.opts.ExactWindow > 0 && len(p.bins) > 0 {
+		/// the bins have to hold exactly the window, or samples leaving it won't be found
+		total := 0.0
+		for _, bin := range p.bins {
+			total += bin.count
+		}
+		if math.Abs(total-float64(p.lastdata.Len())) > 0.5 {
+			log.Println("Stored bins don't match the window ", total, p.lastdata.Len())
+			return false
+		}
+	}
+	p.dist = newDistribution(p.opts.Backend, p.opts.Compression, p.targetage)
+	if p.opts.Backend == BackendCustom {
+		if dist == nil {
+			log.Println("Stored with a custom distribution - it needs one to load into")
+			return false
+		}
+		p.dist = dist
+	}
+	if p.dist != nil {
+		/// if it's missing, start again from empty - it'll warm up from the new data
+		p.datastore.Retrieve(p.storagename+"-dist", maxage, p.dist)
+	}
 	return true
 }
 
@@ -258,7 +513,50 @@ func (p *SigPercentile) SetupStorage(storename string, fs store.Store, howoftent
 	//// next time a stat comes in, we should save to storage
 }
 
+// / Set the clock used to age bins and throttle saves - e.g. a ManualClock when replaying historical data
+func (p *SigPercentile) SetClock(clock Clock) {
+	p.clock = clock
+}
+
+// / Register a callback for whenever the direction changes - see eventSource for the caveats
+func (p *SigPercentile) OnChange(callback func(SignalEvent)) {
+	p.events.onChange(callback)
+}
+
+// / A channel of direction changes. Sends don't block - if the buffer fills up, events are dropped
+func (p *SigPercentile) Events(buffer int) <-chan SignalEvent {
+	return p.events.events(buffer)
+}
+
+// / Close all the channels returned by Events
+func (p *SigPercentile) CloseEvents() {
+	p.events.closeEvents()
+}
+
+// / How many events have been dropped because a channel was full
+func (p *SigPercentile) DroppedEvents() int64 {
+	return p.events.dropped
+}
+
+func (p *SigPercentile) now() time.Time {
+	if p.clock == nil {
+		return time.Now()
+	}
+	return p.clock.Now()
+}
+
 func (p *SigPercentile) Plot() {
+	if p.dist != nil {
+		fmt.Println("Quantiles")
+		quantiles := make([]float64, 40)
+		for i := range quantiles {
+			quantiles[i] = p.dist.Quantile(float64(i) / float64(len(quantiles)-1))
+		}
+		dataplot.Plot(quantiles, 40, 40)
+		fmt.Println("Last percentile")
+		dataplot.PlotManagedSlice(p.lastpercentile, 40, 40)
+		return
+	}
 	fmt.Println("Bins")
 	bins := make([]float64, len(p.bins))
 	for i, bin := range p.bins {
@@ -299,7 +597,7 @@ func (p *SigPercentile) predictIndex(val float64) (predicted int, outofbounds fl
 	return int(offset), 0 /// return the lower expected index - then we can just search up
 }
 
-func (p *SigPercentile) addBucket(val float64) {
+func (p *SigPercentile) addBucket(val float64, now time.Time) {
 	if val > p.lower && val < p.upper {
 		log.Panic("val within range")
 	}
@@ -321,14 +619,14 @@ func (p *SigPercentile) addBucket(val float64) {
 		copy(p.bins[extrabins:], p.bins[:currlen])
 		start := p.lower - (interval * float64(extrabins))
 		for i := 0; i < extrabins; i++ {
-			bin := NewBin(start, interval, float64(i))
+			bin := newBinAt(start, interval, float64(i), now)
 			p.bins[i] = bin
 		}
 		p.lower = start
 	} else {
 		end := p.upper + (interval * float64(extrabins))
 		for i := 0; i < extrabins; i++ {
-			bin := NewBin(p.upper, interval, float64(i))
+			bin := newBinAt(p.upper, interval, float64(i), now)
 			p.bins[currlen+i] = bin
 		}
 		p.upper = end
@@ -336,7 +634,7 @@ func (p *SigPercentile) addBucket(val float64) {
 
 }
 
-func (p *SigPercentile) tryAddFromIndx(val float64, predictedindex int) bool {
+func (p *SigPercentile) tryAddFromIndx(val float64, predictedindex int, now time.Time) bool {
 	if math.IsNaN(val) {
 		log.Panic("NaN fed into try Add From Indx")
 	}
@@ -344,8 +642,9 @@ func (p *SigPercentile) tryAddFromIndx(val float64, predictedindex int) bool {
 		log.Panic("Predicted index is screwed up ", predictedindex)
 	}
 	counter := 0
+	weight := p.weightAt(now)
 	for i := predictedindex; i < len(p.bins); i++ {
-		if p.bins[i].TryAdd(val) {
+		if p.bins[i].tryAddWeightAt(val, weight, now) {
 			/// we're done - return
 			return true
 		}
@@ -358,22 +657,49 @@ func (p *SigPercentile) tryAddFromIndx(val float64, predictedindex int) bool {
 	return false
 }
 
+/*
+*
+The weight of a sample added at t. Rather than decaying every bin, new samples get heavier by 2^(age/halflife)
+relative to decayref - the percentiles are ratios, so it comes to the same thing. Once the weights get too big, all
+the bins are scaled back down and decayref moves up.
+*/
+func (p *SigPercentile) weightAt(t time.Time) float64 {
+	if p.opts.HalfLife <= 0 {
+		return 1
+	}
+	if p.decayref.IsZero() {
+		p.decayref = t
+	}
+	halflives := float64(t.Sub(p.decayref)) / float64(p.opts.HalfLife)
+	if halflives > MAX_DECAY_GROWTH {
+		scale := math.Exp2(-halflives)
+		for _, bin := range p.bins {
+			bin.count *= scale
+		}
+		p.decayref = t
+		halflives = 0
+	}
+	return math.Exp2(halflives)
+}
+
 func (p *SigPercentile) prune() {
+	p.pruneAt(p.now())
+}
+
+func (p *SigPercentile) pruneAt(now time.Time) {
 	///see if we can prune from the end of the array
 	countupper := 0
 	countlower := 0
 	for i := 0; i < len(p.bins); i++ {
-		t := p.bins[len(p.bins)-(i+1)].LastUpdate()
-		if t > p.targetage {
+		if p.prunable(p.bins[len(p.bins)-(i+1)], now) {
 			countupper++
 		} else {
 			break
 		}
 
 	}
-	for i := 0; i < len(p.bins); i++ {
-		t := p.bins[i].LastUpdate()
-		if t > p.targetage {
+	for i := 0; i < len(p.bins)-countupper; i++ {
+		if p.prunable(p.bins[i], now) {
 			countlower++
 		} else {
 			break
@@ -392,15 +718,96 @@ func (p *SigPercentile) prune() {
 	}
 }
 
+// / With an exact window, bins still hold samples however old they are - so only empty ones can go
+func (p *SigPercentile) prunable(bin *Bin, now time.Time) bool {
+	if p.opts.ExactWindow > 0 {
+		return bin.count < 0.5
+	}
+	return bin.age(now) > p.targetage
+}
+
+/*
+*
+Push val into the exact window, taking whatever leaves the window back out of the bins - either the oldest sample,
+once the window is full, or anything older than the window duration.
+*/
+func (p *SigPercentile) slideWindow(val float64, now time.Time) {
+	if p.lastdata.Len() == p.opts.ExactWindow {
+		p.removeSample(float64(p.lastdata.At(0)))
+	}
+	p.lastdata.PushAndResize(storables.StorableFloat(val))
+	if p.lasttimes == nil {
+		return
+	}
+	p.lasttimes.PushAndResize(storables.StorableTime(now))
+	oldest := now.Add(-p.opts.ExactWindowDuration)
+	expired := 0
+	for expired < p.lasttimes.Len()-1 && !time.Time(p.lasttimes.At(expired)).After(oldest) {
+		p.removeSample(float64(p.lastdata.At(expired)))
+		expired++
+	}
+	p.lastdata.DropFront(expired)
+	p.lasttimes.DropFront(expired)
+}
+
+/*
+*
+Take a sample back out of the bin it went into. A sample right on the edge between two bins may come out of the
+neighbour it didn't go into (the edges can move slightly as bins are added), which leaves the total exact.
+*/
+func (p *SigPercentile) removeSample(val float64) {
+	if len(p.bins) == 0 {
+		return /// still warming up - it was never added
+	}
+	predictedindex, outofbounds := p.predictIndex(val)
+	if outofbounds > 0 {
+		predictedindex = len(p.bins) - 1
+	}
+	for i := max(predictedindex-2, 0); i < len(p.bins); i++ {
+		bin := p.bins[i]
+		if bin.lowerval > val+FP_TOLERANCE {
+			break
+		}
+		if val <= bin.upperval+FP_TOLERANCE && bin.count >= 1-FP_TOLERANCE {
+			bin.count--
+			return
+		}
+	}
+	/// shouldn't happen - the bins would be out of step with the window. Leave them be rather than take the wrong sample out
+	log.Println("WARNING sample leaving the window isn't in any bin ", val, predictedindex, p.lower, p.upper)
+}
+
 func (p *SigPercentile) AddData(val float64) {
-	p.storeData()
+	p.AddDataAt(val, p.now())
+}
+
+/*
+*
+AddDataAt adds a sample that happened at time t. Bin ageing, pruning by targetage and how often to save are all driven
+by t rather than the clock, so historical data can be replayed at any speed.
+*/
+func (p *SigPercentile) AddDataAt(val float64, t time.Time) {
+	now := t
+	p.storeData(now)
 	if math.IsNaN(val) {
 		/// we can't handle this - so drop it and hope its the only one
 		log.Println("WARNING NaN passed to SigPercentile: AddData")
 		return
 	}
-	p.lastdata.PushAndResize(storables.StorableFloat(val))
-	if p.lastdata.Len() < p.mindata {
+	if p.opts.ExactWindow > 0 {
+		p.slideWindow(val, now)
+	} else {
+		p.lastdata.PushAndResize(storables.StorableFloat(val))
+	}
+	if p.dist != nil {
+		p.dist.Add(val, now)
+		if p.lastdata.Len() < p.mindata {
+			return
+		}
+		p.signalOn(val, now)
+		return
+	}
+	if len(p.bins) == 0 && p.lastdata.Len() < p.mindata {
 		p.SetRange(val)
 		return
 	}
@@ -412,14 +819,14 @@ func (p *SigPercentile) AddData(val float64) {
 		interval := (p.upper - p.lower) / float64(p.targetnumbins)
 		p.bins = make([]*Bin, p.targetnumbins)
 		for i, _ := range p.bins {
-			p.bins[i] = NewBin(p.lower, interval, float64(i))
+			p.bins[i] = newBinAt(p.lower, interval, float64(i), now)
 		}
 		for _, val := range p.lastdata.Items() {
-			predictedindex, outofbounds := p.predictIndex(float64(val.(storables.StorableFloat)))
+			predictedindex, outofbounds := p.predictIndex(float64(val))
 			if outofbounds != 0 {
 				log.Panic("oob is still non zero, ", val, outofbounds, p.lower, p.upper, len(p.bins))
 			}
-			if !p.tryAddFromIndx(float64(val.(storables.StorableFloat)), predictedindex) {
+			if !p.tryAddFromIndx(float64(val), predictedindex, now) {
 				log.Panic("failed to add value from last data ", val, predictedindex, p.lower, p.upper)
 			}
 		}
@@ -431,7 +838,7 @@ func (p *SigPercentile) AddData(val float64) {
 	if outofbounds != 0 {
 		fmt.Println("Add new bucket for ", val)
 		/// add buckets and prune
-		p.addBucket(val)
+		p.addBucket(val, now)
 		predictedindex, outofbounds = p.predictIndex(val)
 		if outofbounds != 0 {
 			log.Panic("oob is still non zero, ", val, outofbounds)
@@ -441,23 +848,156 @@ func (p *SigPercentile) AddData(val float64) {
 		log.Panic("trying to add a value that's outside range ", val, p.lower, p.upper)
 	}
 
-	if !p.tryAddFromIndx(val, predictedindex) {
+	if !p.tryAddFromIndx(val, predictedindex, now) {
 		log.Panic("Failed to place val after adding bins ", p.lower, p.upper, val)
 	}
 	if len(p.bins) > p.pruneabove {
-		p.prune()
+		p.pruneAt(now)
+	}
+	if p.lastdata.Len() < p.mindata {
+		/// only after a gap longer than the exact window duration - not enough data to signal on
+		p.sigbuy = false
+		p.sigsell = false
+		p.events.update(SignalEvent{
+			Direction:  Neutral,
+			Time:       now,
+			Value:      val,
+			Slope:      math.NaN(),
+			Percentile: math.NaN(),
+		})
+		return
 	}
-	p.checkData(val)
+	p.signalOn(val, now)
 }
 
-func (p *SigPercentile) checkData(val float64) float64 {
+func (p *SigPercentile) signalOn(val float64, now time.Time) {
+	place := p.checkData(val)
+	if p.debounce != nil {
+		p.applyDebounce(place, now)
+	}
+	p.events.update(SignalEvent{
+		Direction:  DirectionOf(p),
+		Time:       now,
+		Value:      val,
+		Slope:      math.NaN(),
+		Percentile: place,
+	})
+}
+
+func (p *SigPercentile) applyDebounce(place float64, now time.Time) {
+	dir := Neutral
+	if p.opts.Debounce.hasBands() {
+		dir = p.debounce.Update(place, now)
+	} else {
+		if p.sigbuy {
+			dir = Buy
+		} else if p.sigsell {
+			dir = Sell
+		}
+		dir = p.debounce.UpdateDirection(dir, now)
+	}
+	p.sigbuy = dir == Buy
+	p.sigsell = dir == Sell
+}
+
+// / The fraction of the data at or below val
+func (p *SigPercentile) cdf(val float64) float64 {
+	if p.dist != nil {
+		return p.dist.CDF(val)
+	}
 	vals := make([]float64, len(p.bins))
 	weights := make([]float64, len(p.bins))
 	for i, bin := range p.bins {
 		vals[i] = bin.MidValue()
 		weights[i] = bin.Count()
 	}
-	place := stat.CDF(val, stat.Empirical, vals, weights)
+	return stat.CDF(val, stat.Empirical, vals, weights)
+}
+
+// / Whether there's enough data to calculate percentiles from
+func (p *SigPercentile) ready() bool {
+	if p.lastdata == nil || p.lastdata.Len() < p.mindata {
+		return false
+	}
+	if p.dist != nil {
+		return p.dist.Count() > 0
+	}
+	return len(p.bins) > 0
+}
+
+/*
+*
+Percentile is the percentile (0 to 1) val would be at - without adding it or changing the signals.
+ok is false until there's at least min data.
+*/
+func (p *SigPercentile) Percentile(val float64) (place float64, ok bool) {
+	if !p.ready() || math.IsNaN(val) {
+		return math.NaN(), false
+	}
+	return p.cdf(val), true
+}
+
+// / Quantile is the value at percentile q (0 to 1), e.g. Quantile(0.1) is the 10th percentile. See Quantiles
+func (p *SigPercentile) Quantile(q float64) (val float64, ok bool) {
+	vals, ok := p.Quantiles([]float64{q})
+	if !ok {
+		return math.NaN(), false
+	}
+	return vals[0], true
+}
+
+/*
+*
+Quantiles is the value at each percentile in qs (0 to 1), interpolating within the bin it falls in.
+ok is false until there's at least min data, or if any q is outside 0 to 1.
+*/
+func (p *SigPercentile) Quantiles(qs []float64) (vals []float64, ok bool) {
+	for _, q := range qs {
+		if !(q >= 0 && q <= 1) {
+			return nil, false
+		}
+	}
+	if !p.ready() {
+		return nil, false
+	}
+	vals = make([]float64, len(qs))
+	if p.dist != nil {
+		for i, q := range qs {
+			vals[i] = p.dist.Quantile(q)
+		}
+		return vals, true
+	}
+	cumulative := make([]float64, len(p.bins))
+	total := 0.0
+	for i, bin := range p.bins {
+		total += bin.Count()
+		cumulative[i] = total
+	}
+	if total <= 0 {
+		return nil, false
+	}
+	for i, q := range qs {
+		target := q * total
+		indx := sort.SearchFloat64s(cumulative, target)
+		if indx == len(p.bins) {
+			indx--
+		}
+		for p.bins[indx].Count() <= 0 && indx < len(p.bins)-1 { /// q == 0 lands on the leading empty bins
+			indx++
+		}
+		bin := p.bins[indx]
+		below := cumulative[indx] - bin.Count()
+		frac := 0.0
+		if bin.Count() > 0 {
+			frac = math.Min(1, math.Max(0, (target-below)/bin.Count()))
+		}
+		vals[i] = bin.lowerval + frac*(bin.upperval-bin.lowerval)
+	}
+	return vals, true
+}
+
+func (p *SigPercentile) checkData(val float64) float64 {
+	place := p.cdf(val)
 	p.lastpercentile.PushAndResize(storables.StorableFloat(place))
 	p.percentiles.Inc(place)
 	sigsell := false
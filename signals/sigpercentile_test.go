@@ -1,14 +1,26 @@
 package signals
 
 import (
+	"encoding/gob"
+	"github.com/paul-at-nangalan/errorhandler/handlers"
 	"github.com/paul-at-nangalan/short-term-store/store"
+	"golang.org/x/exp/rand"
 	"gonum.org/v1/gonum/stat/distuv"
 	"gotest.tools/v3/assert"
+	"io"
+	"math"
+	"sort"
 	"testing"
 	"time"
 )
 
 func genNormalDist(size int, lower, upper float64) []float64 {
+	return genNormalDistFrom(nil, size, lower, upper)
+}
+
+// / New tests should use their own source - the shared one is seeded the same every run, so using it changes the data
+// / every later test gets
+func genNormalDistFrom(src rand.Source, size int, lower, upper float64) []float64 {
 
 	// Define the normal distribution parameters
 	mean := 0.0   // Adjust this to change the mean
@@ -16,6 +28,7 @@ func genNormalDist(size int, lower, upper float64) []float64 {
 	dist := distuv.Normal{
 		Mu:    mean,
 		Sigma: stddev,
+		Src:   src,
 	}
 
 	datapoints := make([]float64, size)
@@ -57,6 +70,13 @@ func fillSig(sig *SigPercentile, size int, lower, upper float64) {
 	}
 }
 
+func fillSigFrom(src rand.Source, sig *SigPercentile, size int, lower, upper float64) {
+	vals := genNormalDistFrom(src, size, lower, upper)
+	for _, val := range vals {
+		sig.AddData(val)
+	}
+}
+
 func TestSigPercentile_Percentile(t *testing.T) {
 	lower := 100.0
 	upper := 200.0
@@ -139,3 +159,483 @@ func Test_StoreAndRestore(t *testing.T) {
 	checkPC(loaded, 175, 0.75, 1.0, t)
 
 }
+
+func TestSigPercentileConfig_Validate(t *testing.T) {
+	_, err := NewSigPercentileFromConfig(SigPercentileConfig{BuyBelow: 0.25, SellAbove: 0.75, MinData: 1000, TargetAge: time.Second})
+	assert.NilError(t, err)
+
+	bad := []SigPercentileConfig{
+		{BuyBelow: 0.25, SellAbove: 0.75, MinData: 1000},
+		{BuyBelow: 0.25, SellAbove: 0.75, MinData: 0, TargetAge: time.Second},
+		{BuyBelow: 25, SellAbove: 75, MinData: 1000, TargetAge: time.Second},
+	}
+	for i, cfg := range bad {
+		if _, err := NewSigPercentileFromConfig(cfg); err == nil {
+			t.Error("Expected an error for bad config ", i, cfg)
+		}
+	}
+
+	/// the original constructor only ever checked the target age
+	sig := NewSigPercentile(25, 75, 0, time.Second)
+	assert.Equal(t, sig.buybelow, 25.0)
+	assert.Equal(t, sig.mindata, 0)
+}
+
+func fillSigAt(src rand.Source, sig *SigPercentile, size int, lower, upper float64, start time.Time, interval time.Duration) time.Time {
+	vals := genNormalDistFrom(src, size, lower, upper)
+	for _, val := range vals {
+		sig.AddDataAt(val, start)
+		start = start.Add(interval)
+	}
+	return start
+}
+
+func TestSigPercentile_AddDataAt(t *testing.T) {
+	lower := 100.0
+	upper := 200.0
+	/// the clock never moves, so any ageing has to come from the event times
+	clock := NewManualClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	sig, err := NewSigPercentileFromConfig(SigPercentileConfig{
+		BuyBelow: 0.25, SellAbove: 0.75, MinData: 1000, TargetAge: time.Hour, Clock: clock,
+	})
+	assert.NilError(t, err)
+	fs := newMemStore()
+	sig.SetupStorage("percentile-at", fs, 10*time.Minute)
+
+	src := rand.NewSource(9)
+	start := clock.Now()
+	next := fillSigAt(src, sig, 3000, lower, upper, start, time.Second)
+	assert.Equal(t, sig.lastsaved, start.Add(40*time.Minute), "Saves should be throttled by event time")
+	checkPC(sig, 120, 0, 0.25, t)
+	checkPC(sig, 175, 0.75, 1.0, t)
+
+	/// 2 hours later, a narrower range - everything outside it should have aged out
+	next = fillSigAt(src, sig, 3000, lower+12, upper-22, next.Add(2*time.Hour), time.Millisecond)
+	sig.pruneAt(next)
+	for _, bin := range sig.bins {
+		if bin.upperval < lower+12 {
+			t.Error("Prune failed to clear out the lower ranges ", bin)
+		}
+		if bin.lowerval > upper-22 {
+			t.Error("Prune failed to clear out upper ranges ", bin)
+		}
+	}
+}
+
+func TestSigPercentile_Debounce(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := SigPercentileConfig{BuyBelow: 0.25, SellAbove: 0.75, MinData: 1000, TargetAge: 24 * time.Hour}
+	countflips := func(sig *SigPercentile) (flips int) {
+		last := Neutral
+		for i, val := range genNormalDistFrom(rand.NewSource(5), 5000, 100, 200) {
+			sig.AddDataAt(val, start.Add(time.Duration(i)*time.Second))
+			if dir := DirectionOf(sig); dir != last {
+				flips++
+				last = dir
+			}
+		}
+		return flips
+	}
+	raw, err := NewSigPercentileFromConfig(cfg)
+	assert.NilError(t, err)
+	rawflips := countflips(raw)
+
+	cfg.Debounce = &DebounceConfig{Confirm: 3}
+	confirmed, err := NewSigPercentileFromConfig(cfg)
+	assert.NilError(t, err)
+	flips := countflips(confirmed)
+	if flips == 0 || flips*2 > rawflips {
+		t.Error("Expected confirmation to at least halve the chatter ", rawflips, flips)
+	}
+
+	cfg.Debounce = &DebounceConfig{
+		Buy:  Band{Enter: 0.25, Exit: 0.4, Below: true},
+		Sell: Band{Enter: 0.75, Exit: 0.6},
+	}
+	banded, err := NewSigPercentileFromConfig(cfg)
+	assert.NilError(t, err)
+	fs := newMemStore()
+	banded.SetupStorage("percentile-debounce", fs, time.Minute)
+	flips = countflips(banded)
+	if flips == 0 || flips >= rawflips {
+		t.Error("Expected the bands to cut the chatter ", rawflips, flips)
+	}
+
+	loaded, isvalid := LoadFromStorageSigPC("percentile-debounce", fs, time.Hour)
+	assert.Equal(t, isvalid, true)
+	assert.DeepEqual(t, *loaded.opts.Debounce, *cfg.Debounce)
+	assert.Assert(t, loaded.debounce != nil, "Debouncer not set up after loading")
+
+	/// only a sell band - it should never buy
+	cfg.Debounce = &DebounceConfig{Sell: Band{Enter: 0.75, Exit: 0.6}}
+	sellonly, err := NewSigPercentileFromConfig(cfg)
+	assert.NilError(t, err)
+	sells := 0
+	for i, val := range genNormalDistFrom(rand.NewSource(5), 5000, 100, 200) {
+		sellonly.AddDataAt(val, start.Add(time.Duration(i)*time.Second))
+		if sellonly.SigBuy() {
+			t.Fatal("Buy signalled without a buy band at ", i)
+		}
+		if sellonly.SigSell() {
+			sells++
+		}
+	}
+	assert.Assert(t, sells > 0, "Expected the sell band to still signal")
+}
+
+func TestSigPercentile_TDigestBackend(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := SigPercentileConfig{BuyBelow: 0.25, SellAbove: 0.75, MinData: 1000, TargetAge: 24 * time.Hour}
+	bins, err := NewSigPercentileFromConfig(cfg)
+	assert.NilError(t, err)
+	cfg.Backend = BackendTDigest
+	digest, err := NewSigPercentileFromConfig(cfg)
+	assert.NilError(t, err)
+	fs := newMemStore()
+	digest.SetupStorage("percentile-tdigest", fs, time.Minute)
+
+	agree := 0
+	vals := genNormalDistFrom(rand.NewSource(11), 5000, 100, 200)
+	for i, val := range vals {
+		bins.AddDataAt(val, start.Add(time.Duration(i)*time.Second))
+		digest.AddDataAt(val, start.Add(time.Duration(i)*time.Second))
+		if DirectionOf(bins) == DirectionOf(digest) {
+			agree++
+		}
+	}
+	assert.Equal(t, len(digest.bins), 0, "The digest backend shouldn't use the bins")
+	if agree < len(vals)*98/100 {
+		t.Error("Expected the backends to mostly agree ", agree, len(vals))
+	}
+	checkPC(digest, 120, 0, 0.25, t)
+	checkPC(digest, 175, 0.75, 1.0, t)
+
+	loaded, isvalid := LoadFromStorageSigPC("percentile-tdigest", fs, time.Hour)
+	assert.Equal(t, isvalid, true)
+	assert.Equal(t, loaded.opts.Backend, BackendTDigest)
+	assert.Assert(t, loaded.dist != nil, "Distribution not restored")
+	/// the last few samples weren't saved
+	assert.Assert(t, math.Abs(loaded.cdf(150)-digest.cdf(150)) < 0.01, loaded.cdf(150), digest.cdf(150))
+
+	_, err = NewSigPercentileFromConfig(SigPercentileConfig{
+		BuyBelow: 0.25, SellAbove: 0.75, MinData: 1000, TargetAge: time.Hour, Backend: DistributionBackend(7),
+	})
+	assert.ErrorContains(t, err, "backend")
+}
+
+// / Keeps every value - the simplest Distribution there is, for testing a custom one
+type sortedDistribution struct {
+	vals []float64
+}
+
+func (p *sortedDistribution) Add(val float64, t time.Time) {
+	i := sort.SearchFloat64s(p.vals, val)
+	p.vals = append(p.vals, 0)
+	copy(p.vals[i+1:], p.vals[i:])
+	p.vals[i] = val
+}
+
+func (p *sortedDistribution) CDF(val float64) float64 {
+	if len(p.vals) == 0 {
+		return math.NaN()
+	}
+	return float64(sort.SearchFloat64s(p.vals, val)) / float64(len(p.vals))
+}
+
+func (p *sortedDistribution) Quantile(q float64) float64 {
+	if len(p.vals) == 0 {
+		return math.NaN()
+	}
+	return p.vals[int(q*float64(len(p.vals)-1))]
+}
+
+func (p *sortedDistribution) Count() float64 {
+	return float64(len(p.vals))
+}
+
+func (p *sortedDistribution) Encode(buffer io.Writer) {
+	handlers.PanicOnError(gob.NewEncoder(buffer).Encode(p.vals))
+}
+
+func (p *sortedDistribution) Decode(buffer io.Reader) {
+	handlers.PanicOnError(gob.NewDecoder(buffer).Decode(&p.vals))
+}
+
+func TestSigPercentile_CustomDistribution(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := SigPercentileConfig{BuyBelow: 0.25, SellAbove: 0.75, MinData: 1000, TargetAge: 24 * time.Hour,
+		Distribution: &sortedDistribution{}}
+	sig, err := NewSigPercentileFromConfig(cfg)
+	assert.NilError(t, err)
+	fs := newMemStore()
+	sig.SetupStorage("percentile-custom", fs, time.Minute)
+	vals := genNormalDistFrom(rand.NewSource(13), 5000, 100, 200)
+	for i, val := range vals {
+		sig.AddDataAt(val, start.Add(time.Duration(i)*time.Second))
+	}
+	assert.Equal(t, len(sig.bins), 0, "A custom distribution shouldn't use the bins")
+	place, ok := sig.Percentile(vals[0])
+	assert.Equal(t, ok, true)
+	assert.Equal(t, place, cfg.Distribution.CDF(vals[0]))
+	sort.Float64s(vals)
+	median, ok := sig.Quantile(0.5)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, median, vals[(len(vals)-1)/2])
+
+	_, isvalid := LoadFromStorageSigPC("percentile-custom", fs, time.Hour)
+	assert.Equal(t, isvalid, false, "Shouldn't load without a distribution to load into")
+	loaded, isvalid := LoadFromStorageSigPCWith("percentile-custom", fs, time.Hour, &sortedDistribution{})
+	assert.Equal(t, isvalid, true)
+	assert.Equal(t, loaded.opts.Backend, BackendCustom)
+	/// the last few samples weren't saved
+	assert.Assert(t, loaded.dist.Count() > 4900, loaded.dist.Count())
+
+	cfg.Backend = BackendTDigest
+	_, err = NewSigPercentileFromConfig(cfg)
+	assert.ErrorContains(t, err, "either a backend or a distribution")
+	cfg.Backend = BackendCustom
+	cfg.Distribution = nil
+	_, err = NewSigPercentileFromConfig(cfg)
+	assert.ErrorContains(t, err, "needs a distribution")
+}
+
+func TestSigPercentile_HalfLife(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := SigPercentileConfig{BuyBelow: 0.25, SellAbove: 0.75, MinData: 1000, TargetAge: 24 * time.Hour}
+	raw, err := NewSigPercentileFromConfig(cfg)
+	assert.NilError(t, err)
+	cfg.HalfLife = 30 * time.Minute
+	decayed, err := NewSigPercentileFromConfig(cfg)
+	assert.NilError(t, err)
+	fs := newMemStore()
+	decayed.SetupStorage("percentile-halflife", fs, time.Minute)
+
+	/// 20 hours of 100 to 200, then 2 hours of 160 to 200 - the interior bins never age out
+	for _, sig := range []*SigPercentile{raw, decayed} {
+		next := fillSigAt(rand.NewSource(13), sig, 20000, 100, 200, start, 3600*time.Millisecond)
+		fillSigAt(rand.NewSource(14), sig, 7200, 160, 200, next, time.Second)
+	}
+	if place := raw.cdf(158); place < 0.2 {
+		t.Error("Expected the old data to still count without a half life ", place)
+	}
+	if place := decayed.cdf(158); place > 0.1 {
+		t.Error("Expected the old data to have decayed away ", place)
+	}
+	checkPC(decayed, 165, 0, 0.25, t)
+
+	loaded, isvalid := LoadFromStorageSigPC("percentile-halflife", fs, time.Hour)
+	assert.Equal(t, isvalid, true)
+	assert.Equal(t, loaded.opts.HalfLife, cfg.HalfLife)
+	assert.Assert(t, !loaded.decayref.IsZero(), "Decay reference not restored")
+
+	bad := cfg
+	bad.Backend = BackendTDigest
+	_, err = NewSigPercentileFromConfig(bad)
+	assert.ErrorContains(t, err, "half life")
+}
+
+func TestSigPercentile_HalfLifeRescale(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sig, err := NewSigPercentileFromConfig(SigPercentileConfig{
+		BuyBelow: 0.25, SellAbove: 0.75, MinData: 1000, TargetAge: 24 * time.Hour, HalfLife: time.Second,
+	})
+	assert.NilError(t, err)
+	/// thousands of half lives - the weights would overflow without rescaling
+	fillSigAt(rand.NewSource(15), sig, 5000, 100, 200, start, time.Second)
+	for _, bin := range sig.bins {
+		if math.IsInf(bin.count, 0) || math.IsNaN(bin.count) {
+			t.Fatal("Bin weight overflowed ", bin)
+		}
+	}
+	assert.Assert(t, sig.decayref.After(start), "Expected the weights to have been rescaled")
+	place := sig.cdf(150)
+	assert.Assert(t, place >= 0 && place <= 1, place)
+}
+
+func binTotal(sig *SigPercentile) (total float64) {
+	for _, bin := range sig.bins {
+		total += bin.count
+	}
+	return total
+}
+
+func TestSigPercentile_ExactWindow(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sig, err := NewSigPercentileFromConfig(SigPercentileConfig{
+		BuyBelow: 0.25, SellAbove: 0.75, MinData: 1000, TargetAge: time.Hour, ExactWindow: 2000,
+	})
+	assert.NilError(t, err)
+
+	next := fillSigAt(rand.NewSource(16), sig, 5000, 100, 200, start, time.Second)
+	assert.Equal(t, binTotal(sig), 2000.0)
+	/// a full window of 150 to 200 - the older samples should have all come back out
+	fillSigAt(rand.NewSource(17), sig, 2000, 150, 200, next, time.Second)
+	assert.Equal(t, binTotal(sig), 2000.0)
+	assert.Equal(t, sig.cdf(149), 0.0)
+	for _, bin := range sig.bins {
+		if bin.count < 0 {
+			t.Fatal("Negative bin count ", bin)
+		}
+		if bin.upperval < 150-FP_TOLERANCE && bin.count != 0 {
+			t.Error("Sample from outside the window still counted ", bin)
+		}
+	}
+	/// compare with the exact rank over the window
+	for _, val := range []float64{160, 175, 190} {
+		below := 0
+		for _, sample := range sig.lastdata.Items() {
+			if float64(sample) <= val {
+				below++
+			}
+		}
+		exact := float64(below) / float64(sig.lastdata.Len())
+		if place := sig.cdf(val); math.Abs(place-exact) > 0.01 {
+			t.Error("Percentile doesn't match the window ", val, place, exact)
+		}
+	}
+
+	/// nothing's older than the target age that matters - only the empty bins should go
+	sig.pruneAt(next.Add(24 * time.Hour))
+	assert.Equal(t, binTotal(sig), 2000.0)
+	assert.Assert(t, sig.lower > 149 && sig.bins[0].count > 0, sig.lower)
+}
+
+func TestSigPercentile_ExactWindowDuration(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := SigPercentileConfig{
+		BuyBelow: 0.25, SellAbove: 0.75, MinData: 100, TargetAge: time.Hour,
+		ExactWindow: 5000, ExactWindowDuration: 10 * time.Minute,
+	}
+	sig, err := NewSigPercentileFromConfig(cfg)
+	assert.NilError(t, err)
+	fs := newMemStore()
+	sig.SetupStorage("percentile-exact", fs, time.Minute)
+
+	next := fillSigAt(rand.NewSource(18), sig, 3000, 100, 200, start, time.Second)
+	assert.Equal(t, sig.lastdata.Len(), 600)
+	assert.Equal(t, sig.lasttimes.Len(), 600)
+	assert.Equal(t, binTotal(sig), 600.0)
+
+	loaded, isvalid := LoadFromStorageSigPC("percentile-exact", fs, time.Hour)
+	assert.Equal(t, isvalid, true)
+	assert.Equal(t, loaded.opts.ExactWindowDuration, cfg.ExactWindowDuration)
+	assert.Equal(t, loaded.lasttimes.Len(), loaded.lastdata.Len())
+	assert.Equal(t, binTotal(loaded), float64(loaded.lastdata.Len()))
+
+	/// after a long gap, there's only one sample in the window - too few to signal on
+	sig.AddDataAt(100, next.Add(time.Hour))
+	assert.Equal(t, sig.lastdata.Len(), 1)
+	assert.Equal(t, binTotal(sig), 1.0)
+	assert.Equal(t, DirectionOf(sig), Neutral)
+
+	bad := []SigPercentileConfig{
+		{BuyBelow: 0.25, SellAbove: 0.75, MinData: 100, TargetAge: time.Hour, ExactWindow: 50},
+		{BuyBelow: 0.25, SellAbove: 0.75, MinData: 100, TargetAge: time.Hour, ExactWindowDuration: time.Minute},
+		{BuyBelow: 0.25, SellAbove: 0.75, MinData: 100, TargetAge: time.Hour, ExactWindow: 500, HalfLife: time.Minute},
+		{BuyBelow: 0.25, SellAbove: 0.75, MinData: 100, TargetAge: time.Hour, ExactWindow: 500, Backend: BackendTDigest},
+	}
+	for i, cfg := range bad {
+		if _, err := NewSigPercentileFromConfig(cfg); err == nil {
+			t.Error("Expected an error for bad config ", i, cfg)
+		}
+	}
+}
+
+func TestSigPercentile_ExactWindowOutOfStep(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := SigPercentileConfig{
+		BuyBelow: 0.25, SellAbove: 0.75, MinData: 100, TargetAge: time.Hour,
+		ExactWindow: 500, ExactWindowDuration: 10 * time.Minute,
+	}
+	sig, err := NewSigPercentileFromConfig(cfg)
+	assert.NilError(t, err)
+	fs := newMemStore()
+	sig.SetupStorage("percentile-outofstep", fs, time.Minute)
+	fillSigAt(rand.NewSource(19), sig, 1000, 100, 200, start, time.Second)
+	_, isvalid := LoadFromStorageSigPC("percentile-outofstep", fs, time.Hour)
+	assert.Equal(t, isvalid, true)
+
+	/// as if the window times were saved at a different time to the rest
+	sig.lasttimes.DropFront(1)
+	fs.Store("percentile-outofstep-lasttimes", sig.lasttimes)
+	_, isvalid = LoadFromStorageSigPC("percentile-outofstep", fs, time.Hour)
+	assert.Equal(t, isvalid, false, "Expected the window times to have to match the window")
+
+	/// the window and its times in step, but not the bins
+	sig.lastdata.DropFront(10)
+	sig.lasttimes.DropFront(9)
+	fs.Store("percentile-outofstep-lastdata", sig.lastdata)
+	fs.Store("percentile-outofstep-lasttimes", sig.lasttimes)
+	_, isvalid = LoadFromStorageSigPC("percentile-outofstep", fs, time.Hour)
+	assert.Equal(t, isvalid, false, "Expected the bins to have to match the window")
+
+	/// a sample that's in no bin is left alone rather than panicking
+	total := binTotal(sig)
+	sig.removeSample(1e9)
+	assert.Equal(t, binTotal(sig), total)
+}
+
+func TestSigPercentile_Queries(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := SigPercentileConfig{BuyBelow: 0.25, SellAbove: 0.75, MinData: 1000, TargetAge: 24 * time.Hour}
+	sig, err := NewSigPercentileFromConfig(cfg)
+	assert.NilError(t, err)
+	_, ok := sig.Percentile(150)
+	assert.Equal(t, ok, false, "Shouldn't answer before min data")
+	_, ok = sig.Quantile(0.5)
+	assert.Equal(t, ok, false, "Shouldn't answer before min data")
+
+	vals := genNormalDistFrom(rand.NewSource(19), 5000, 100, 200)
+	for i, val := range vals {
+		sig.AddDataAt(val, start.Add(time.Duration(i)*time.Second))
+	}
+	sorted := append([]float64{}, vals...)
+	sort.Float64s(sorted)
+
+	/// queries mustn't change anything
+	lastlen := sig.lastpercentile.Len()
+	buy, sell := sig.SigBuy(), sig.SigSell()
+	place, ok := sig.Percentile(101.5)
+	assert.Equal(t, ok, true)
+	assert.Assert(t, place < 0.01, place)
+	place, ok = sig.Percentile(150)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, place, sig.cdf(150))
+	assert.Equal(t, sig.lastpercentile.Len(), lastlen)
+	assert.Equal(t, sig.SigBuy(), buy)
+	assert.Equal(t, sig.SigSell(), sell)
+
+	qs := []float64{0, 0.1, 0.25, 0.5, 0.75, 0.9, 1}
+	quantiles, ok := sig.Quantiles(qs)
+	assert.Equal(t, ok, true)
+	interval := (sig.upper - sig.lower) / float64(len(sig.bins))
+	for i, q := range qs {
+		exact := sorted[int(math.Min(q*float64(len(sorted)), float64(len(sorted)-1)))]
+		if math.Abs(quantiles[i]-exact) > 2*interval {
+			t.Error("Quantile is off ", q, quantiles[i], exact)
+		}
+		if i > 0 && quantiles[i] < quantiles[i-1] {
+			t.Error("Quantiles should be in order ", qs, quantiles)
+		}
+		single, ok := sig.Quantile(q)
+		assert.Equal(t, ok, true)
+		assert.Equal(t, single, quantiles[i])
+	}
+	_, ok = sig.Quantiles([]float64{0.5, 1.5})
+	assert.Equal(t, ok, false, "q outside 0 to 1")
+	_, ok = sig.Quantile(math.NaN())
+	assert.Equal(t, ok, false, "NaN q")
+
+	cfg.Backend = BackendTDigest
+	digest, err := NewSigPercentileFromConfig(cfg)
+	assert.NilError(t, err)
+	for i, val := range vals {
+		digest.AddDataAt(val, start.Add(time.Duration(i)*time.Second))
+	}
+	median, ok := digest.Quantile(0.5)
+	assert.Equal(t, ok, true)
+	assert.Assert(t, math.Abs(median-sorted[len(sorted)/2]) < 1, median, sorted[len(sorted)/2])
+	place, ok = digest.Percentile(median)
+	assert.Equal(t, ok, true)
+	assert.Assert(t, math.Abs(place-0.5) < 0.01, place)
+}
@@ -0,0 +1,249 @@
+package signals
+
+import (
+	"github.com/paul-at-nangalan/short-term-store/store"
+	perfstats "github.com/paul-at-nangalan/stats/stats"
+	"sync"
+	"time"
+)
+
+/*
+*
+SyncSigCurve wraps a SigCurve so data can be fed in on one goroutine while others poll the signals or stats.
+Adding a sample takes the write lock, and that includes any save to storage triggered by it, so a save never sees a
+half updated curve. Don't keep using the wrapped SigCurve directly once it's wrapped.
+*/
+type SyncSigCurve struct {
+	lock sync.RWMutex
+	sig  *SigCurve
+}
+
+func NewSyncSigCurve(sig *SigCurve) *SyncSigCurve {
+	return &SyncSigCurve{
+		sig: sig,
+	}
+}
+
+func (p *SyncSigCurve) AddVarianceSample(variance float64, t time.Time) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.sig.AddVarianceSample(variance, t)
+}
+
+func (p *SyncSigCurve) RejectedSamples() int64 {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.sig.RejectedSamples()
+}
+
+func (p *SyncSigCurve) LastFit() PolyFit {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.sig.LastFit()
+}
+
+func (p *SyncSigCurve) Snapshot() SigCurveSnapshot {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.sig.Snapshot()
+}
+
+func (p *SyncSigCurve) EffectiveMinSlope() float64 {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.sig.EffectiveMinSlope()
+}
+
+func (p *SyncSigCurve) SigBuy() bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.sig.SigBuy()
+}
+
+func (p *SyncSigCurve) SigSell() bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.sig.SigSell()
+}
+
+func (p *SyncSigCurve) SetStatsPrefix(prefix string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.sig.SetStatsPrefix(prefix)
+}
+
+func (p *SyncSigCurve) GetStatsCounters() []perfstats.Stat {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.sig.GetStatsCounters()
+}
+
+func (p *SyncSigCurve) Plot() {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	p.sig.Plot()
+}
+
+func (p *SyncSigCurve) SetupStorage(storename string, fs store.Store, howoftentosave time.Duration) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.sig.SetupStorage(storename, fs, howoftentosave)
+}
+
+func (p *SyncSigCurve) SetClock(clock Clock) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.sig.SetClock(clock)
+}
+
+func (p *SyncSigCurve) LogLevel(level int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.sig.LogLevel(level)
+}
+
+func (p *SyncSigCurve) OnChange(callback func(SignalEvent)) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.sig.OnChange(callback)
+}
+
+func (p *SyncSigCurve) Events(buffer int) <-chan SignalEvent {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.sig.Events(buffer)
+}
+
+func (p *SyncSigCurve) CloseEvents() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.sig.CloseEvents()
+}
+
+func (p *SyncSigCurve) DroppedEvents() int64 {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.sig.DroppedEvents()
+}
+
+// / SyncSigPercentile is the SigPercentile equivalent of SyncSigCurve
+type SyncSigPercentile struct {
+	lock sync.RWMutex
+	sig  *SigPercentile
+}
+
+func NewSyncSigPercentile(sig *SigPercentile) *SyncSigPercentile {
+	return &SyncSigPercentile{
+		sig: sig,
+	}
+}
+
+func (p *SyncSigPercentile) AddData(val float64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.sig.AddData(val)
+}
+
+func (p *SyncSigPercentile) AddDataAt(val float64, t time.Time) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.sig.AddDataAt(val, t)
+}
+
+func (p *SyncSigPercentile) SetRange(val float64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.sig.SetRange(val)
+}
+
+func (p *SyncSigPercentile) SetClock(clock Clock) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.sig.SetClock(clock)
+}
+
+func (p *SyncSigPercentile) SigBuy() bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.sig.SigBuy()
+}
+
+func (p *SyncSigPercentile) SigSell() bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.sig.SigSell()
+}
+
+func (p *SyncSigPercentile) SetStatsPrefix(prefix string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.sig.SetStatsPrefix(prefix)
+}
+
+func (p *SyncSigPercentile) GetStatsCounters() []perfstats.Stat {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.sig.GetStatsCounters()
+}
+
+func (p *SyncSigPercentile) Plot() {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	p.sig.Plot()
+}
+
+func (p *SyncSigPercentile) SetupStorage(storename string, fs store.Store, howoftentosave time.Duration) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.sig.SetupStorage(storename, fs, howoftentosave)
+}
+
+func (p *SyncSigPercentile) Percentile(val float64) (float64, bool) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.sig.Percentile(val)
+}
+
+func (p *SyncSigPercentile) Quantile(q float64) (float64, bool) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.sig.Quantile(q)
+}
+
+func (p *SyncSigPercentile) Quantiles(qs []float64) ([]float64, bool) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.sig.Quantiles(qs)
+}
+
+func (p *SyncSigPercentile) OnChange(callback func(SignalEvent)) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.sig.OnChange(callback)
+}
+
+func (p *SyncSigPercentile) Events(buffer int) <-chan SignalEvent {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.sig.Events(buffer)
+}
+
+func (p *SyncSigPercentile) CloseEvents() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.sig.CloseEvents()
+}
+
+func (p *SyncSigPercentile) DroppedEvents() int64 {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.sig.DroppedEvents()
+}
+
+var (
+	_ Signal = &SyncSigCurve{}
+	_ Signal = &SyncSigPercentile{}
+
+	_ StatsPrefixer = &SyncSigCurve{}
+	_ StatsPrefixer = &SyncSigPercentile{}
+)
@@ -0,0 +1,112 @@
+package signals
+
+import (
+	"bytes"
+	"github.com/paul-at-nangalan/short-term-store/store"
+	"math"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+// / the file store writes on its own goroutine - this keeps everything in memory so the race detector only sees our code
+type memStore struct {
+	lock sync.Mutex
+	data map[string][]byte
+}
+
+func newMemStore() *memStore {
+	return &memStore{data: make(map[string][]byte)}
+}
+
+func (p *memStore) Store(name string, data store.Encoder) {
+	buffer := &bytes.Buffer{}
+	data.Encode(buffer)
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.data[name] = buffer.Bytes()
+}
+
+func (p *memStore) Retrieve(name string, maxage time.Duration, t store.Decoder) (isvalid bool) {
+	p.lock.Lock()
+	data, ok := p.data[name]
+	p.lock.Unlock()
+	if !ok {
+		return false
+	}
+	t.Decode(bytes.NewReader(data))
+	return true
+}
+
+// / run with -race
+func TestSyncSigCurve_Concurrent(t *testing.T) {
+	sig := NewSyncSigCurve(NewSigCurve(1000, 900, 0.35, 10, 0.45))
+	sig.SetupStorage("sync-curve", newMemStore(), 20*time.Millisecond)
+
+	done := make(chan bool)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				sig.SigBuy()
+				sig.SigSell()
+				sig.GetStatsCounters()
+				time.Sleep(time.Microsecond)
+			}
+		}()
+	}
+	start := time.Now()
+	for i := 0; i < 1500; i++ {
+		sig.AddVarianceSample(math.Sin(float64(i)/500)*1000, start.Add(time.Duration(i)*time.Millisecond))
+	}
+	close(done)
+	wg.Wait()
+}
+
+func TestSyncSigPercentile_Concurrent(t *testing.T) {
+	sig := NewSyncSigPercentile(NewSigPercentile(0.25, 0.75, 200, time.Hour))
+	sig.SetupStorage("sync-percentile", newMemStore(), 20*time.Millisecond)
+
+	done := make(chan bool)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				sig.SigBuy()
+				sig.SigSell()
+				sig.GetStatsCounters()
+				sig.Percentile(150)
+				sig.Quantiles([]float64{0.1, 0.5, 0.9})
+				time.Sleep(time.Microsecond)
+			}
+		}()
+	}
+	///two writers
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				sig.AddData(100 + rand.Float64()*100)
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(done)
+	wg.Wait()
+}
@@ -0,0 +1,242 @@
+package signals
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	TDIGEST_DEFAULT_COMPRESSION = 100
+	TDIGEST_BUFFER_FACTOR       = 5 /// buffer this many times the compression before merging into the centroids
+)
+
+// / Exported fields so it can be gob encoded
+type centroid struct {
+	Mean   float64
+	Weight float64
+}
+
+/*
+*
+TDigest is a merging t-digest (Dunning) - a sketch of a distribution in a bounded number of centroids, which are
+small near the tails and bigger in the middle, so the extreme percentiles stay accurate. Values are buffered
+and merged in batches.
+compression - roughly how many centroids to keep (more is more accurate), 100 is a good start
+*/
+type TDigest struct {
+	compression float64
+	centroids   []centroid
+	total       float64 /// weight in the centroids
+	buffer      []float64
+	min, max    float64
+}
+
+func NewTDigest(compression float64) *TDigest {
+	if compression <= 0 {
+		compression = TDIGEST_DEFAULT_COMPRESSION
+	}
+	return &TDigest{
+		compression: compression,
+		buffer:      make([]float64, 0, int(compression)*TDIGEST_BUFFER_FACTOR),
+	}
+}
+
+func (p *TDigest) Add(val float64) {
+	if p.Count() == 0 || val < p.min {
+		p.min = val
+	}
+	if p.Count() == 0 || val > p.max {
+		p.max = val
+	}
+	p.buffer = append(p.buffer, val)
+	if len(p.buffer) >= int(p.compression)*TDIGEST_BUFFER_FACTOR {
+		p.flush()
+	}
+}
+
+func (p *TDigest) Count() float64 {
+	return p.total + float64(len(p.buffer))
+}
+
+// / Merge the buffer into the centroids
+func (p *TDigest) flush() {
+	if len(p.buffer) == 0 {
+		return
+	}
+	all := make([]centroid, 0, len(p.centroids)+len(p.buffer))
+	all = append(all, p.centroids...)
+	for _, val := range p.buffer {
+		all = append(all, centroid{Mean: val, Weight: 1})
+	}
+	p.buffer = p.buffer[:0]
+	p.centroids = p.merge(all, p.centroids[:0])
+	p.total = 0
+	for _, c := range p.centroids {
+		p.total += c.Weight
+	}
+}
+
+// / Merge the centroids in all (which it sorts) into as few as the compression allows, appending them to into
+func (p *TDigest) merge(all []centroid, into []centroid) []centroid {
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Mean < all[j].Mean
+	})
+	total := 0.0
+	for _, c := range all {
+		total += c.Weight
+	}
+	merged := make([]centroid, 0, len(all))
+	cur := all[0]
+	sofar := 0.0
+	kleft := p.scale(0)
+	for _, c := range all[1:] {
+		qright := (sofar + cur.Weight + c.Weight) / total
+		if p.scale(qright)-kleft <= 1 {
+			cur.Mean += (c.Mean - cur.Mean) * c.Weight / (cur.Weight + c.Weight)
+			cur.Weight += c.Weight
+			continue
+		}
+		merged = append(merged, cur)
+		sofar += cur.Weight
+		kleft = p.scale(sofar / total)
+		cur = c
+	}
+	merged = append(merged, cur)
+	return append(into, merged...)
+}
+
+// / The k1 scale function - centroids can span at most 1 in k
+func (p *TDigest) scale(q float64) float64 {
+	return p.compression / (2 * math.Pi) * math.Asin(2*math.Min(1, math.Max(0, q))-1)
+}
+
+/*
+*
+How much weight is at or below val - interpolating between the centroids, with half of each centroid's weight
+either side of its mean. The buffer is counted exactly, so this doesn't need to merge it first.
+*/
+func (p *TDigest) weightBelow(val float64) float64 {
+	if p.Count() == 0 || val < p.min {
+		return 0
+	}
+	if val >= p.max {
+		return p.Count()
+	}
+	weight := 0.0
+	for _, bufval := range p.buffer {
+		if bufval <= val {
+			weight++
+		}
+	}
+	n := len(p.centroids)
+	if n == 0 {
+		return weight
+	}
+	first := p.centroids[0]
+	if val < first.Mean {
+		return weight + (first.Weight/2)*(val-p.min)/(first.Mean-p.min)
+	}
+	cum := first.Weight / 2
+	for i := 0; i < n-1; i++ {
+		left := p.centroids[i]
+		right := p.centroids[i+1]
+		gap := (left.Weight + right.Weight) / 2
+		if val < right.Mean {
+			return weight + cum + gap*(val-left.Mean)/(right.Mean-left.Mean)
+		}
+		cum += gap
+	}
+	last := p.centroids[n-1]
+	return weight + cum + (last.Weight/2)*(val-last.Mean)/(p.max-last.Mean)
+}
+
+// / The fraction of the data at or below val - NaN if there's no data
+func (p *TDigest) CDF(val float64) float64 {
+	if p.Count() == 0 {
+		return math.NaN()
+	}
+	return p.weightBelow(val) / p.Count()
+}
+
+// / The value at quantile q (0 to 1) - NaN if there's no data
+func (p *TDigest) Quantile(q float64) float64 {
+	return quantileOf(p.mergedCentroids(), p.min, p.max, q)
+}
+
+// / The centroids with the buffer merged in, without changing the digest
+func (p *TDigest) mergedCentroids() []centroid {
+	if len(p.buffer) == 0 {
+		return p.centroids
+	}
+	all := make([]centroid, 0, len(p.centroids)+len(p.buffer))
+	all = append(all, p.centroids...)
+	for _, val := range p.buffer {
+		all = append(all, centroid{Mean: val, Weight: 1})
+	}
+	return p.merge(all, nil)
+}
+
+// / The inverse of weightBelow, over sorted centroids
+func quantileOf(centroids []centroid, min, max, q float64) float64 {
+	n := len(centroids)
+	if n == 0 {
+		return math.NaN()
+	}
+	if q <= 0 {
+		return min
+	}
+	if q >= 1 {
+		return max
+	}
+	total := 0.0
+	for _, c := range centroids {
+		total += c.Weight
+	}
+	target := q * total
+	first := centroids[0]
+	if target < first.Weight/2 {
+		return min + (first.Mean-min)*target/(first.Weight/2)
+	}
+	cum := first.Weight / 2
+	for i := 0; i < n-1; i++ {
+		left := centroids[i]
+		right := centroids[i+1]
+		gap := (left.Weight + right.Weight) / 2
+		if target < cum+gap {
+			return left.Mean + (right.Mean-left.Mean)*(target-cum)/gap
+		}
+		cum += gap
+	}
+	last := centroids[n-1]
+	return math.Min(max, last.Mean+(max-last.Mean)*(target-cum)/(last.Weight/2))
+}
+
+// / Exported fields so it can be gob encoded
+type tdigestState struct {
+	Compression float64
+	Centroids   []centroid
+	Buffer      []float64
+	Min, Max    float64
+}
+
+func (p *TDigest) state() tdigestState {
+	return tdigestState{
+		Compression: p.compression,
+		Centroids:   p.centroids,
+		Buffer:      p.buffer,
+		Min:         p.min,
+		Max:         p.max,
+	}
+}
+
+func tdigestFromState(state tdigestState) *TDigest {
+	p := NewTDigest(state.Compression)
+	p.centroids = state.Centroids
+	for _, c := range p.centroids {
+		p.total += c.Weight
+	}
+	p.buffer = append(p.buffer, state.Buffer...)
+	p.min = state.Min
+	p.max = state.Max
+	return p
+}
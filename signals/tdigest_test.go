@@ -0,0 +1,82 @@
+package signals
+
+import (
+	"bytes"
+	"golang.org/x/exp/rand"
+	"gotest.tools/v3/assert"
+	"math"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestTDigest_Accuracy(t *testing.T) {
+	rnd := rand.New(rand.NewSource(3))
+	digest := NewTDigest(100)
+	vals := make([]float64, 100000)
+	for i := range vals {
+		vals[i] = math.Exp(rnd.NormFloat64()) /// skewed, with a long upper tail
+		digest.Add(vals[i])
+	}
+	sort.Float64s(vals)
+	assert.Equal(t, digest.Count(), float64(len(vals)))
+	assert.Equal(t, digest.Quantile(0), vals[0])
+	assert.Equal(t, digest.Quantile(1), vals[len(vals)-1])
+
+	for _, q := range []float64{0.001, 0.01, 0.1, 0.25, 0.5, 0.75, 0.9, 0.99, 0.999} {
+		exact := vals[int(q*float64(len(vals)))]
+		/// compare ranks rather than values - the error should shrink towards the tails
+		tol := 0.01 * math.Max(4*q*(1-q), 0.05)
+		if rank := digest.CDF(exact); math.Abs(rank-q) > tol {
+			t.Error("CDF is off at ", q, exact, rank)
+		}
+		est := digest.Quantile(q)
+		if rank := float64(sort.SearchFloat64s(vals, est)) / float64(len(vals)); math.Abs(rank-q) > tol {
+			t.Error("Quantile is off at ", q, est, exact, rank)
+		}
+	}
+	if len(digest.centroids) > 200 {
+		t.Error("Too many centroids for the compression ", len(digest.centroids))
+	}
+}
+
+func TestTDigest_Empty(t *testing.T) {
+	digest := NewTDigest(0)
+	assert.Equal(t, digest.compression, float64(TDIGEST_DEFAULT_COMPRESSION))
+	assert.Assert(t, math.IsNaN(digest.CDF(1)))
+	assert.Assert(t, math.IsNaN(digest.Quantile(0.5)))
+
+	digest.Add(5)
+	assert.Equal(t, digest.CDF(4), 0.0)
+	assert.Equal(t, digest.CDF(5), 1.0)
+	assert.Equal(t, digest.Quantile(0.5), 5.0)
+}
+
+func TestRotatingTDigest_Rotate(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	dist := NewRotatingTDigest(100, time.Hour)
+	/// an hour of 0 to 1, then an hour of 10 to 11
+	for i := 0; i < 3600; i++ {
+		dist.Add(float64(i)/3600, start.Add(time.Duration(i)*time.Second))
+	}
+	assert.Assert(t, math.Abs(dist.Quantile(0.5)-0.5) < 0.01, dist.Quantile(0.5))
+	for i := 3600; i < 7200; i++ {
+		dist.Add(10+float64(i-3600)/3600, start.Add(time.Duration(i)*time.Second))
+	}
+	/// the first hour should have rotated out
+	assert.Equal(t, dist.Count(), 3600.0)
+	assert.Equal(t, dist.CDF(9), 0.0)
+	assert.Assert(t, math.Abs(dist.Quantile(0.5)-10.5) < 0.01, dist.Quantile(0.5))
+
+	/// a gap longer than the target age clears everything
+	dist.Add(100, start.Add(4*time.Hour))
+	assert.Equal(t, dist.Count(), 1.0)
+
+	buffer := &bytes.Buffer{}
+	dist.Encode(buffer)
+	loaded := &RotatingTDigest{}
+	loaded.Decode(buffer)
+	assert.Equal(t, loaded.Count(), dist.Count())
+	assert.Equal(t, loaded.span, dist.span)
+	assert.Equal(t, loaded.Quantile(0.5), dist.Quantile(0.5))
+}